@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+var properties = map[string]func(a *Analysis) bool{
+	"regular":            (*Analysis).IsRegular,
+	"proper":             (*Analysis).IsProper,
+	"cycle-free":         (*Analysis).IsCycleFree,
+	"epsilon-free":       (*Analysis).IsEpsilonFree,
+	"not-left-recursive": func(a *Analysis) bool { return !a.IsLeftRecursive() },
+	"no-useless":         func(a *Analysis) bool { return !a.HasUselessSymbols() },
+}
+
+func runAnalyze(e *env, args []string) int {
+	fs := e.flags("analyze", "grammar")
+	check := fs.String("check", "", "comma-separated properties that must hold: regular, proper, cycle-free, epsilon-free, not-left-recursive, no-useless")
+	quiet := fs.Bool("q", false, "only report failed checks")
+	if status, ok := parseFlags(fs, args, 1); !ok {
+		return status
+	}
+
+	var checks []string
+	if *check != "" {
+		checks = strings.Split(*check, ",")
+	}
+	for _, name := range checks {
+		if _, ok := properties[name]; !ok {
+			e.errorf("Unknown property '%s'", name)
+			return exitError
+		}
+	}
+	g, err := e.loadGrammar(fs.Arg(0))
+	if err != nil {
+		e.errorf("%s", err.Error())
+		return exitError
+	}
+
+	a := g.Analyze()
+	if !*quiet {
+		fmt.Fprint(e.stdout, a.String())
+	}
+	status := exitOK
+	for _, name := range checks {
+		if !properties[name](a) {
+			e.errorf("Property '%s' does not hold", name)
+			status = exitFailure
+		}
+	}
+	return status
+}
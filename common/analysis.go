@@ -0,0 +1,275 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Witness is a derivation exhibiting a property of a variable, given as the
+// rules applied to it and then to the variable each rule leads to
+type Witness struct {
+	Variable Variable
+	Rules    []int
+}
+
+// witnesses returns for every variable deriving itself through edges the
+// shortest such derivation, in the order of variables
+func witnesses(variables []Variable, edges map[Variable][]derivation) []Witness {
+	var res []Witness
+	for _, v := range variables {
+		// Breadth-first search back to v, remembering the edge each variable was reached by
+		parent := make(map[Variable]derivation)
+		from := make(map[Variable]Variable)
+		queue := []Variable{v}
+		found := false
+		for len(queue) > 0 && !found {
+			u := queue[0]
+			queue = queue[1:]
+			for _, e := range edges[u] {
+				if e.to == v {
+					parent[v], from[v] = e, u
+					found = true
+					break
+				}
+				if _, seen := parent[e.to]; !seen {
+					parent[e.to], from[e.to] = e, u
+					queue = append(queue, e.to)
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+		var rules []int
+		for u := v; ; {
+			rules = append([]int{parent[u].rule}, rules...)
+			if u = from[u]; u == v {
+				break
+			}
+		}
+		res = append(res, Witness{Variable: v, Rules: rules})
+	}
+	return res
+}
+
+// Analysis is a report of the properties of a grammar, with witnesses of the
+// properties that do not hold
+type Analysis struct {
+	gram *Grammar
+	// Sets holds the nullable variables and the FIRST and FOLLOW sets
+	Sets *FirstFollow
+	// Nullable lists the variables deriving ε
+	Nullable []Variable
+	// EpsilonRules lists the ε-rules, but for a start variable occurring on no right-hand side
+	EpsilonRules []int
+	// Unproductive lists the variables deriving no string of terminals
+	Unproductive []Variable
+	// Unreachable lists the variables occurring in no sentential form
+	Unreachable []Variable
+	// Useless lists the variables occurring in no derivation of a string of
+	// terminals, the unproductive ones and those only reachable through them
+	Useless []Variable
+	// Cycles holds a derivation A =>+ A for every variable deriving itself
+	Cycles []Witness
+	// LeftRecursion holds a derivation A =>+ A α for every left-recursive variable
+	LeftRecursion []Witness
+	// RightLinear tells whether every rule is A -> w or A -> w B, w a string of terminals
+	RightLinear bool
+	// LeftLinear tells whether every rule is A -> w or A -> B w, w a string of terminals
+	LeftLinear bool
+}
+
+// IsRegular returns whether the grammar is right or left linear, which is
+// sufficient but not necessary for its language to be regular
+func (a *Analysis) IsRegular() bool {
+	return a.RightLinear || a.LeftLinear
+}
+
+func (a *Analysis) IsLeftRecursive() bool {
+	return len(a.LeftRecursion) > 0
+}
+
+func (a *Analysis) IsCycleFree() bool {
+	return len(a.Cycles) == 0
+}
+
+func (a *Analysis) IsEpsilonFree() bool {
+	return len(a.EpsilonRules) == 0
+}
+
+func (a *Analysis) HasUselessSymbols() bool {
+	return len(a.Useless) > 0
+}
+
+// IsProper returns whether the grammar is cycle-free, ε-free and has no useless symbols
+func (a *Analysis) IsProper() bool {
+	return a.IsCycleFree() && a.IsEpsilonFree() && !a.HasUselessSymbols()
+}
+
+// Analyze computes the properties of g
+func (g *Grammar) Analyze() *Analysis {
+	sets := g.FirstFollow()
+	a := &Analysis{
+		gram:          g,
+		Sets:          sets,
+		Cycles:        witnesses(g.Variables.Data, g.singleDerivations(sets.Nullable)),
+		LeftRecursion: witnesses(g.Variables.Data, g.leftCorners(sets.Nullable)),
+		RightLinear:   true,
+		LeftLinear:    true,
+	}
+
+	a.EpsilonRules = g.epsilonRules()
+	for _, rule := range g.Rules {
+		var vars []int
+		for j, sym := range rule.Expr {
+			if !isTerminal(sym) {
+				vars = append(vars, j)
+			}
+		}
+		if len(vars) > 1 || (len(vars) == 1 && vars[0] != len(rule.Expr)-1) {
+			a.RightLinear = false
+		}
+		if len(vars) > 1 || (len(vars) == 1 && vars[0] != 0) {
+			a.LeftLinear = false
+		}
+	}
+
+	productive := g.productiveVariables()
+	reachable := g.reachableVariables()
+	// Variables reachable without going through unproductive variables
+	useful := map[Variable]bool{g.StartVariable(): productive[g.StartVariable()]}
+	queue := []Variable{g.StartVariable()}
+	for len(queue) > 0 && useful[g.StartVariable()] {
+		v := queue[0]
+		queue = queue[1:]
+	nextRule:
+		for _, rule := range g.Rules {
+			if rule.Variable != v {
+				continue
+			}
+			for _, sym := range rule.Expr {
+				if ref, ok := sym.(RuleRef); ok && !productive[ref.Variable] {
+					continue nextRule
+				}
+			}
+			for _, sym := range rule.Expr {
+				if ref, ok := sym.(RuleRef); ok && !useful[ref.Variable] {
+					useful[ref.Variable] = true
+					queue = append(queue, ref.Variable)
+				}
+			}
+		}
+	}
+	for _, v := range g.Variables.Data {
+		if sets.Nullable[v] {
+			a.Nullable = append(a.Nullable, v)
+		}
+		if !productive[v] {
+			a.Unproductive = append(a.Unproductive, v)
+		}
+		if !reachable[v] {
+			a.Unreachable = append(a.Unreachable, v)
+		}
+		if !useful[v] {
+			a.Useless = append(a.Useless, v)
+		}
+	}
+	return a
+}
+
+// derivation returns the sentential forms of a witness, "A => α => ..."
+func (a *Analysis) derivation(w Witness) string {
+	forms := []string{w.Variable.String()}
+	expr := Expr{Ref(w.Variable)}
+	for _, r := range w.Rules {
+		rule := a.gram.Rules[r]
+		for i, sym := range expr {
+			if ref, ok := sym.(RuleRef); ok && ref.Variable == rule.Variable {
+				expr = append(append(append(Expr{}, expr[:i]...), rule.Expr...), expr[i+1:]...)
+				break
+			}
+		}
+		forms = append(forms, strings.TrimSpace(expr.String()))
+	}
+	return strings.Join(forms, " => ")
+}
+
+func (a *Analysis) String() string {
+	var sb strings.Builder
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	variables := func(vs []Variable) string {
+		names := make([]string, len(vs))
+		for i, v := range vs {
+			names[i] = v.String()
+		}
+		return strings.Join(names, ", ")
+	}
+	rules := func(rs []int) string {
+		names := make([]string, len(rs))
+		for i, r := range rs {
+			names[i] = strings.TrimSpace(a.gram.Rules[r].String())
+		}
+		return strings.Join(names, "; ")
+	}
+	// Character classes are written as such rather than quoted
+	classes := a.gram.Classes()
+	describe := func(t Terminal) string {
+		if slices.Contains(classes, CharClass(t)) {
+			return t.String()
+		}
+		return DescribeTerminal(t)
+	}
+	regular := yesNo(a.IsRegular())
+	if a.RightLinear {
+		regular += " (right-linear)"
+	} else if a.LeftLinear {
+		regular += " (left-linear)"
+	}
+	fmt.Fprintf(&sb, "Regular: %s\n", regular)
+	fmt.Fprintf(&sb, "Left recursive: %s\n", yesNo(a.IsLeftRecursive()))
+	for _, w := range a.LeftRecursion {
+		fmt.Fprintf(&sb, "  %s\n", a.derivation(w))
+	}
+	fmt.Fprintf(&sb, "Proper: %s\n", yesNo(a.IsProper()))
+	fmt.Fprintf(&sb, "Cycle-free: %s\n", yesNo(a.IsCycleFree()))
+	for _, w := range a.Cycles {
+		fmt.Fprintf(&sb, "  %s\n", a.derivation(w))
+	}
+	fmt.Fprintf(&sb, "Epsilon-free: %s\n", yesNo(a.IsEpsilonFree()))
+	if !a.IsEpsilonFree() {
+		fmt.Fprintf(&sb, "  %s\n", rules(a.EpsilonRules))
+	}
+	fmt.Fprintf(&sb, "Useless symbols: %s\n", yesNo(a.HasUselessSymbols()))
+	if a.HasUselessSymbols() {
+		fmt.Fprintf(&sb, "  useless: %s\n", variables(a.Useless))
+	}
+	if len(a.Unproductive) > 0 {
+		fmt.Fprintf(&sb, "  unproductive: %s\n", variables(a.Unproductive))
+	}
+	if len(a.Unreachable) > 0 {
+		fmt.Fprintf(&sb, "  unreachable: %s\n", variables(a.Unreachable))
+	}
+	fmt.Fprintf(&sb, "Nullable: %s\n", variables(a.Nullable))
+	fmt.Fprintf(&sb, "FIRST / FOLLOW:\n")
+	for _, v := range a.gram.Variables.Data {
+		first := make([]string, 0, len(a.Sets.First[v].Data))
+		for _, t := range a.Sets.First[v].Data {
+			first = append(first, describe(t))
+		}
+		if a.Sets.Nullable[v] {
+			first = append(first, "ε")
+		}
+		follow := make([]string, 0, len(a.Sets.Follow[v].Data))
+		for _, t := range a.Sets.Follow[v].Data {
+			follow = append(follow, describe(t))
+		}
+		fmt.Fprintf(&sb, "  %s: {%s} / {%s}\n", v, strings.Join(first, ", "), strings.Join(follow, ", "))
+	}
+	return sb.String()
+}
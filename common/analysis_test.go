@@ -0,0 +1,159 @@
+package common
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name          string
+		rules         []Rule
+		regular       bool
+		proper        bool
+		nullable      []Variable
+		epsilonRules  []int
+		useless       []Variable
+		unproductive  []Variable
+		unreachable   []Variable
+		cycles        []Witness
+		leftRecursion []Witness
+		// report holds lines expected in the printed report
+		report []string
+	}{
+		{
+			name: "right-linear",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Ref("S")}),
+				NewRule("S", Expr{Literal("b")}),
+			},
+			regular: true,
+			proper:  true,
+			report:  []string{"Regular: yes (right-linear)", "  S: {'a', 'b'} / {end of input}"},
+		},
+		{
+			name: "left recursive",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("S"), Literal("+"), Ref("M")}),
+				NewRule("S", Expr{Ref("M")}),
+				NewRule("M", Expr{Ref("M"), Literal("*"), Literal("x")}),
+				NewRule("M", Expr{Literal("x")}),
+			},
+			proper: true,
+			leftRecursion: []Witness{
+				{Variable: "S", Rules: []int{0}},
+				{Variable: "M", Rules: []int{2}},
+			},
+			report: []string{"Left recursive: yes", "  S => S '+' M"},
+		},
+		{
+			name: "indirect left recursion through nullable",
+			rules: []Rule{
+				NewRule("A", Expr{Ref("E"), Ref("B"), Literal("a")}),
+				NewRule("A", Expr{Literal("b")}),
+				NewRule("B", Expr{Ref("A"), Literal("c")}),
+				NewRule("E", Expr{}),
+			},
+			nullable:     []Variable{"E"},
+			epsilonRules: []int{3},
+			leftRecursion: []Witness{
+				{Variable: "A", Rules: []int{0, 2}},
+				{Variable: "B", Rules: []int{2, 0}},
+			},
+			report: []string{"  A => E B 'a' => E A 'c' 'a'", "Epsilon-free: no", "  E ->"},
+		},
+		{
+			name: "cycle",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A")}),
+				NewRule("S", Expr{Literal("s")}),
+				NewRule("A", Expr{Ref("B"), Ref("S")}),
+				NewRule("B", Expr{}),
+			},
+			nullable:     []Variable{"B"},
+			epsilonRules: []int{3},
+			cycles: []Witness{
+				{Variable: "S", Rules: []int{0, 2}},
+				{Variable: "A", Rules: []int{2, 0}},
+			},
+			leftRecursion: []Witness{
+				{Variable: "S", Rules: []int{0, 2}},
+				{Variable: "A", Rules: []int{2, 0}},
+			},
+			report: []string{"Cycle-free: no", "  S => A => B S"},
+		},
+		{
+			name: "useless symbols",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a")}),
+				NewRule("S", Expr{Ref("A"), Ref("B")}),
+				NewRule("A", Expr{Literal("a"), Ref("A")}),
+				NewRule("B", Expr{Literal("b")}),
+				NewRule("C", Expr{Literal("c")}),
+			},
+			useless:      []Variable{"A", "B", "C"},
+			unproductive: []Variable{"A"},
+			unreachable:  []Variable{"C"},
+			report:       []string{"Useless symbols: yes", "  useless: A, B, C", "  unproductive: A", "  unreachable: C"},
+		},
+		{
+			name: "nullable start",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Ref("T")}),
+				NewRule("S", Expr{}),
+				NewRule("T", Expr{Literal("b")}),
+			},
+			regular:  true,
+			proper:   true,
+			nullable: []Variable{"S"},
+			report:   []string{"Epsilon-free: yes", "Nullable: S", "  S: {'a', ε} / {end of input}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			a := g.Analyze()
+			if a.IsRegular() != tt.regular {
+				t.Errorf("IsRegular() = %v, want %v", a.IsRegular(), tt.regular)
+			}
+			if a.IsProper() != tt.proper {
+				t.Errorf("IsProper() = %v, want %v", a.IsProper(), tt.proper)
+			}
+			if !slices.Equal(a.Nullable, tt.nullable) {
+				t.Errorf("Nullable = %v, want %v", a.Nullable, tt.nullable)
+			}
+			if !slices.Equal(a.EpsilonRules, tt.epsilonRules) {
+				t.Errorf("EpsilonRules = %v, want %v", a.EpsilonRules, tt.epsilonRules)
+			}
+			if !slices.Equal(a.Useless, tt.useless) {
+				t.Errorf("Useless = %v, want %v", a.Useless, tt.useless)
+			}
+			if !slices.Equal(a.Unproductive, tt.unproductive) {
+				t.Errorf("Unproductive = %v, want %v", a.Unproductive, tt.unproductive)
+			}
+			if !slices.Equal(a.Unreachable, tt.unreachable) {
+				t.Errorf("Unreachable = %v, want %v", a.Unreachable, tt.unreachable)
+			}
+			equalWitnesses := func(a, b Witness) bool {
+				return a.Variable == b.Variable && slices.Equal(a.Rules, b.Rules)
+			}
+			if !slices.EqualFunc(a.Cycles, tt.cycles, equalWitnesses) {
+				t.Errorf("Cycles = %v, want %v", a.Cycles, tt.cycles)
+			}
+			if !slices.EqualFunc(a.LeftRecursion, tt.leftRecursion, equalWitnesses) {
+				t.Errorf("LeftRecursion = %v, want %v", a.LeftRecursion, tt.leftRecursion)
+			}
+			report := strings.Split(a.String(), "\n")
+			for _, line := range tt.report {
+				if !slices.Contains(report, line) {
+					t.Errorf("String() has no line %q:\n%s", line, a)
+				}
+			}
+		})
+	}
+}
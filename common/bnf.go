@@ -0,0 +1,450 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A grammar file lists rules of the form
+//
+//	Sum -> Sum '+' Product | Product ;
+//
+// Quoted strings are terminals matched literally, identifiers are variables
+// unless declared as token kinds with %token, matched against Token.Kind:
+//
+//	%token NUMBER IDENT
+//
+// Character classes written as in regular expressions match a single character
+// of the input, making scannerless grammars compact:
+//
+//	Ident -> [a-zA-Z_] Rest ;
+//	Rest -> [a-zA-Z_0-9] Rest | ε ;
+//	Letter -> \p{L} ;
+//
+// An empty alternative or ε derives the empty string. EBNF operators ? (optional),
+// * (repetition), + (repetition at least once) and grouping with parentheses are
+// desugared into fresh right-recursive variables. The semicolon ending a rule can
+// be omitted, comments start with # or // and run to the end of the line.
+//
+// An alternative may end with a label and annotations, values being identifiers,
+// numbers or quoted strings. The grammar may be named and given a start
+// variable other than the variable of the first rule:
+//
+//	%name Arithmetic ;
+//	%start Sum ;
+//	Sum -> Sum '+' Product @Add @assoc=left @prec=1 | Product ;
+
+// classSyntax matches the character classes of grammar files: bracketed classes,
+// Unicode classes and the Perl classes \d, \s and \w
+const classSyntax = `\[\^?(?:\[:\^?[a-z]+:\]|[^\]\\\n]|\\.)+\]|\\[pP](?:\{\w+\}|[A-Z])|\\[dDsSwW]`
+
+var bnfTokens = []TokenDef{
+	{Kind: "space", Pattern: `\s+`, Skip: true},
+	{Kind: "comment", Pattern: `(?:#|//)[^\n]*`, Skip: true},
+	{Kind: "%token", Pattern: `%token\b`},
+	{Kind: "%start", Pattern: `%start\b`},
+	{Kind: "%name", Pattern: `%name\b`},
+	{Kind: "identifier", Pattern: `[A-Za-z_][A-Za-z0-9_']*`},
+	{Kind: "number", Pattern: `[0-9]+`},
+	{Kind: "string", Pattern: `'(?:[^'\\\n]|\\.)*'|"(?:[^"\\\n]|\\.)*"`},
+	{Kind: "class", Pattern: classSyntax},
+	{Kind: "->", Pattern: `->|::=`},
+	{Kind: "ε", Pattern: `ε`},
+	{Kind: "|", Pattern: `\|`},
+	{Kind: ";", Pattern: `;`},
+	{Kind: "(", Pattern: `\(`},
+	{Kind: ")", Pattern: `\)`},
+	{Kind: "?", Pattern: `\?`},
+	{Kind: "*", Pattern: `\*`},
+	{Kind: "+", Pattern: `\+`},
+	{Kind: "@", Pattern: `@`},
+	{Kind: "=", Pattern: `=`},
+}
+
+// bnfItem is a symbol or parenthesized group of alternatives, with an optional EBNF operator
+type bnfItem struct {
+	token Token
+	group [][]bnfItem
+	op    Terminal
+}
+
+// bnfMeta holds the label and annotations ending an alternative
+type bnfMeta struct {
+	label       string
+	annotations map[string]string
+}
+
+type bnfRule struct {
+	lhs  Token
+	alts [][]bnfItem
+	meta []bnfMeta
+}
+
+type bnfParser struct {
+	input  string
+	tokens []Token
+	pos    int
+	// kinds holds the declared token kinds
+	kinds map[string]Token
+	// opts holds the start variable and name of the grammar, if declared
+	opts  []GrammarOption
+	rules []bnfRule
+	// used holds the variables taken by rules and desugaring
+	used OrderedSet[Variable]
+	out  []Rule
+	// fresh holds the rules of variables introduced by desugaring, following the rules of the file
+	fresh []Rule
+}
+
+// ParseGrammar reads a grammar in BNF with EBNF extensions, its start variable
+// being the %start variable, the variable of the first rule by default
+func ParseGrammar(r io.Reader) (*Grammar, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lexer, err := NewRegexLexer(bnfTokens)
+	if err != nil {
+		return nil, err
+	}
+	p := &bnfParser{
+		input: string(data),
+		kinds: make(map[string]Token),
+		used:  NewOrderedSet[Variable](),
+	}
+	if p.tokens, err = lexer.Tokenize(p.input); err != nil {
+		return nil, err
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	if err := p.desugar(); err != nil {
+		return nil, err
+	}
+	return NewGrammar(p.out, p.opts...)
+}
+
+func (p *bnfParser) peek(offset int) Terminal {
+	if p.pos+offset >= len(p.tokens) {
+		return EndOfInput
+	}
+	return p.tokens[p.pos+offset].Kind
+}
+
+func (p *bnfParser) next() Token {
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+// errorAt returns an error located at the start of tok
+func (p *bnfParser) errorAt(tok Token, format string, args ...any) error {
+	line, col := LineColumn(p.input, tok.Span.Start)
+	return fmt.Errorf("%s at %d:%d", fmt.Sprintf(format, args...), line, col)
+}
+
+// unexpected returns the error of the current token not being any of expected
+func (p *bnfParser) unexpected(expected string) error {
+	if p.pos >= len(p.tokens) {
+		line, col := LineColumn(p.input, len(p.input))
+		return fmt.Errorf("Unexpected end of input at %d:%d, expected %s", line, col, expected)
+	}
+	tok := p.tokens[p.pos]
+	line, col := LineColumn(p.input, tok.Span.Start)
+	return fmt.Errorf("Unexpected '%s' at %d:%d, expected %s", tok.Lexeme, line, col, expected)
+}
+
+func (p *bnfParser) parse() error {
+	for p.pos < len(p.tokens) {
+		switch {
+		case p.peek(0) == "%token":
+			p.next()
+			for p.peek(0) == "identifier" && p.peek(1) != "->" {
+				tok := p.next()
+				p.kinds[tok.Lexeme] = tok
+			}
+			if p.peek(0) == ";" {
+				p.next()
+			}
+		case p.peek(0) == "%start":
+			p.next()
+			if p.peek(0) != "identifier" {
+				return p.unexpected("a variable")
+			}
+			p.opts = append(p.opts, WithStart(Variable(p.next().Lexeme)))
+			if p.peek(0) == ";" {
+				p.next()
+			}
+		case p.peek(0) == "%name":
+			p.next()
+			name, err := p.value()
+			if err != nil {
+				return err
+			}
+			p.opts = append(p.opts, WithName(name))
+			if p.peek(0) == ";" {
+				p.next()
+			}
+		case p.peek(0) == "identifier" && p.peek(1) == "->":
+			lhs := p.next()
+			p.next()
+			alts, meta, err := p.alternatives()
+			if err != nil {
+				return err
+			}
+			if p.peek(0) == ";" {
+				p.next()
+			}
+			p.rules = append(p.rules, bnfRule{lhs: lhs, alts: alts, meta: meta})
+			p.used.Insert(Variable(lhs.Lexeme))
+		default:
+			if p.peek(0) == "identifier" {
+				p.pos++
+				return p.unexpected("'->'")
+			}
+			return p.unexpected("a rule")
+		}
+	}
+	if len(p.rules) == 0 {
+		return fmt.Errorf("Grammar has no rules")
+	}
+	for _, rule := range p.rules {
+		if tok, ok := p.kinds[rule.lhs.Lexeme]; ok {
+			return p.errorAt(tok, "Token kind '%s' is also defined as a variable", tok.Lexeme)
+		}
+	}
+	return nil
+}
+
+// alternatives parses sequences separated by '|', up to the end of the rule or
+// group, along with the label and annotations ending each of them
+func (p *bnfParser) alternatives() ([][]bnfItem, []bnfMeta, error) {
+	var alts [][]bnfItem
+	var metas []bnfMeta
+	for {
+		seq, err := p.sequence()
+		if err != nil {
+			return nil, nil, err
+		}
+		meta, err := p.meta()
+		if err != nil {
+			return nil, nil, err
+		}
+		alts = append(alts, seq)
+		metas = append(metas, meta)
+		if p.peek(0) != "|" {
+			return alts, metas, nil
+		}
+		p.next()
+	}
+}
+
+// meta parses the labels, @Label, and annotations, @key=value, ending an alternative
+func (p *bnfParser) meta() (bnfMeta, error) {
+	var meta bnfMeta
+	for p.peek(0) == "@" {
+		at := p.next()
+		if p.peek(1) != "=" {
+			if meta.label != "" {
+				return meta, p.errorAt(at, "Alternative already labeled '%s'", meta.label)
+			}
+			label, err := p.value()
+			if err != nil {
+				return meta, err
+			}
+			meta.label = label
+			continue
+		}
+		if p.peek(0) != "identifier" {
+			return meta, p.unexpected("an annotation key")
+		}
+		key := p.next().Lexeme
+		p.next()
+		value, err := p.value()
+		if err != nil {
+			return meta, err
+		}
+		if meta.annotations == nil {
+			meta.annotations = make(map[string]string)
+		}
+		meta.annotations[key] = value
+	}
+	return meta, nil
+}
+
+// value parses an identifier, a number or a quoted string
+func (p *bnfParser) value() (string, error) {
+	switch p.peek(0) {
+	case "identifier", "number":
+		return p.next().Lexeme, nil
+	case "string":
+		return unquote(p.next().Lexeme), nil
+	}
+	return "", p.unexpected("an identifier, a number or a string")
+}
+
+func (p *bnfParser) sequence() ([]bnfItem, error) {
+	var seq []bnfItem
+	for {
+		var item bnfItem
+		switch p.peek(0) {
+		case "ε":
+			p.next()
+			continue
+		case "string":
+			item.token = p.next()
+			if len(item.token.Lexeme) == 2 {
+				return nil, p.errorAt(item.token, "Empty terminal, use ε for the empty string")
+			}
+		case "class":
+			item.token = p.next()
+		case "identifier":
+			// An identifier followed by an arrow starts the next rule
+			if p.peek(1) == "->" {
+				return seq, nil
+			}
+			item.token = p.next()
+		case "(":
+			open := p.next()
+			alts, meta, err := p.alternatives()
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range meta {
+				if m.label != "" || m.annotations != nil {
+					return nil, p.errorAt(open, "Labels and annotations are only allowed on the alternatives of rules")
+				}
+			}
+			if p.peek(0) != ")" {
+				if p.pos >= len(p.tokens) {
+					return nil, p.errorAt(open, "Unclosed '('")
+				}
+				return nil, p.unexpected("')'")
+			}
+			item.token = open
+			item.group = alts
+			p.next()
+		default:
+			return seq, nil
+		}
+		switch p.peek(0) {
+		case "?", "*", "+":
+			item.op = p.next().Kind
+		}
+		seq = append(seq, item)
+	}
+}
+
+// desugar turns the parsed rules into plain rules, checking variables are defined
+func (p *bnfParser) desugar() error {
+	for _, rule := range p.rules {
+		for i, alt := range rule.alts {
+			expr, err := p.expr(Variable(rule.lhs.Lexeme), alt)
+			if err != nil {
+				return err
+			}
+			out := NewRule(Variable(rule.lhs.Lexeme), expr)
+			out.Label = rule.meta[i].label
+			out.Annotations = rule.meta[i].annotations
+			p.out = append(p.out, out)
+		}
+	}
+	p.out = append(p.out, p.fresh...)
+	return nil
+}
+
+func (p *bnfParser) expr(lhs Variable, seq []bnfItem) (Expr, error) {
+	expr := Expr{}
+	for _, item := range seq {
+		syms, err := p.item(lhs, item)
+		if err != nil {
+			return nil, err
+		}
+		expr = append(expr, syms...)
+	}
+	return expr, nil
+}
+
+// item returns the symbols standing for an item, adding rules for fresh
+// variables standing for groups and EBNF operators
+func (p *bnfParser) item(lhs Variable, item bnfItem) (Expr, error) {
+	alts := item.group
+	if alts == nil {
+		sym, err := p.symbol(item.token)
+		if err != nil {
+			return nil, err
+		}
+		if item.op == "" {
+			return Expr{sym}, nil
+		}
+		alts = [][]bnfItem{{{token: item.token}}}
+	}
+	if item.op == "" && len(alts) == 1 {
+		return p.expr(lhs, alts[0])
+	}
+
+	suffix := map[Terminal]string{"": "_group", "?": "_opt", "*": "_rep", "+": "_rep"}[item.op]
+	v := freshVariable(&p.used, lhs.String()+suffix)
+	for _, alt := range alts {
+		expr, err := p.expr(v, alt)
+		if err != nil {
+			return nil, err
+		}
+		switch item.op {
+		case "*", "+":
+			// X* -> X X* | ε and X+ -> X X+ | X
+			p.fresh = append(p.fresh, NewRule(v, append(append(Expr{}, expr...), Ref(v))))
+			if item.op == "+" {
+				p.fresh = append(p.fresh, NewRule(v, expr))
+			}
+		default:
+			p.fresh = append(p.fresh, NewRule(v, expr))
+		}
+	}
+	if item.op == "?" || item.op == "*" {
+		p.fresh = append(p.fresh, NewRule(v, Expr{}))
+	}
+	return Expr{Ref(v)}, nil
+}
+
+func (p *bnfParser) symbol(tok Token) (Symbol, error) {
+	switch tok.Kind {
+	case "string":
+		return Literal(unquote(tok.Lexeme)), nil
+	case "class":
+		class := CharClass(tok.Lexeme)
+		if _, err := class.Ranges(); err != nil {
+			return nil, p.errorAt(tok, "%s", err.Error())
+		}
+		return class, nil
+	}
+	if _, ok := p.kinds[tok.Lexeme]; ok {
+		return Terminal(tok.Lexeme), nil
+	}
+	for _, rule := range p.rules {
+		if rule.lhs.Lexeme == tok.Lexeme {
+			return Ref(Variable(tok.Lexeme)), nil
+		}
+	}
+	return nil, p.errorAt(tok, "Undefined variable '%s'", tok.Lexeme)
+}
+
+// unquote returns the text of a quoted terminal, the lexer only accepts
+// backslashes followed by a character
+func unquote(lexeme string) string {
+	var sb strings.Builder
+	escapes := map[byte]byte{'n': '\n', 't': '\t', 'r': '\r'}
+	for i := 1; i < len(lexeme)-1; i++ {
+		c := lexeme[i]
+		if c == '\\' {
+			i++
+			c = lexeme[i]
+			if e, ok := escapes[c]; ok {
+				c = e
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,206 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGrammar(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		rules  []Rule
+		start  Variable
+		gname  string
+		err    string
+	}{
+		{
+			name: "bnf",
+			source: `
+# Sums of products
+Sum -> Sum '+' Product | Product ;
+Product ::= Product "*" Term | Term
+Term -> '1' | '2'
+`,
+			rules: []Rule{
+				NewRule("Sum", Expr{Ref("Sum"), Literal("+"), Ref("Product")}),
+				NewRule("Sum", Expr{Ref("Product")}),
+				NewRule("Product", Expr{Ref("Product"), Literal("*"), Ref("Term")}),
+				NewRule("Product", Expr{Ref("Term")}),
+				NewRule("Term", Expr{Literal("1")}),
+				NewRule("Term", Expr{Literal("2")}),
+			},
+		},
+		{
+			name:   "empty alternatives",
+			source: "S -> 'a' S | ε ; T -> | 'b' // comment",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Ref("S")}),
+				NewRule("S", Expr{}),
+				NewRule("T", Expr{}),
+				NewRule("T", Expr{Literal("b")}),
+			},
+		},
+		{
+			name:   "token kinds",
+			source: "%token NUMBER PLUS;\nE -> E PLUS NUMBER | NUMBER",
+			rules: []Rule{
+				NewRule("E", Expr{Ref("E"), Terminal("PLUS"), Terminal("NUMBER")}),
+				NewRule("E", Expr{Terminal("NUMBER")}),
+			},
+		},
+		{
+			name:   "escapes",
+			source: `S -> '\'' "\"" '\\' '\n'`,
+			rules: []Rule{
+				NewRule("S", Expr{Literal("'"), Literal("\""), Literal("\\"), Literal("\n")}),
+			},
+		},
+		{
+			name:   "ebnf",
+			source: "List -> '[' (Item (',' Item)*)? ']' ; Item -> 'x'+ | ('y' | 'z')",
+			rules: []Rule{
+				NewRule("List", Expr{Literal("["), Ref("List_opt"), Literal("]")}),
+				NewRule("Item", Expr{Ref("Item_rep")}),
+				NewRule("Item", Expr{Ref("Item_group")}),
+				NewRule("List_opt_rep", Expr{Literal(","), Ref("Item"), Ref("List_opt_rep")}),
+				NewRule("List_opt_rep", Expr{}),
+				NewRule("List_opt", Expr{Ref("Item"), Ref("List_opt_rep")}),
+				NewRule("List_opt", Expr{}),
+				NewRule("Item_rep", Expr{Literal("x"), Ref("Item_rep")}),
+				NewRule("Item_rep", Expr{Literal("x")}),
+				NewRule("Item_group", Expr{Literal("y")}),
+				NewRule("Item_group", Expr{Literal("z")}),
+			},
+		},
+		{
+			name:   "fresh name collision",
+			source: "S -> 'a'? S_opt ; S_opt -> 'b'",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("S_opt_1"), Ref("S_opt")}),
+				NewRule("S_opt", Expr{Literal("b")}),
+				NewRule("S_opt_1", Expr{Literal("a")}),
+				NewRule("S_opt_1", Expr{}),
+			},
+		},
+		{
+			name:   "start and name",
+			source: "%name 'Sums and terms' ;\n%start T ;\nS -> S '+' T | T ; T -> '1'",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("S"), Literal("+"), Ref("T")}),
+				NewRule("S", Expr{Ref("T")}),
+				NewRule("T", Expr{Literal("1")}),
+			},
+			start: "T",
+			gname: "Sums and terms",
+		},
+		{
+			name:   "labels and annotations",
+			source: "S -> S '+' T @Add @assoc=left @prec=1 | T @'unit rule' ; T -> '1' @doc='one'",
+			rules: []Rule{
+				{Variable: "S", Expr: Expr{Ref("S"), Literal("+"), Ref("T")}, Label: "Add", Annotations: map[string]string{"assoc": "left", "prec": "1"}},
+				{Variable: "S", Expr: Expr{Ref("T")}, Label: "unit rule"},
+				{Variable: "T", Expr: Expr{Literal("1")}, Annotations: map[string]string{"doc": "one"}},
+			},
+		},
+		{
+			name:   "character classes",
+			source: `Ident -> [a-zA-Z_] [\w']* ; Other -> \p{Greek} | \pN | \d | [^\]\\] | [[:alpha:]-]`,
+			rules: []Rule{
+				NewRule("Ident", Expr{CharClass("[a-zA-Z_]"), Ref("Ident_rep")}),
+				NewRule("Other", Expr{CharClass(`\p{Greek}`)}),
+				NewRule("Other", Expr{CharClass(`\pN`)}),
+				NewRule("Other", Expr{CharClass(`\d`)}),
+				NewRule("Other", Expr{CharClass(`[^\]\\]`)}),
+				NewRule("Other", Expr{CharClass("[[:alpha:]-]")}),
+				NewRule("Ident_rep", Expr{CharClass(`[\w']`), Ref("Ident_rep")}),
+				NewRule("Ident_rep", Expr{}),
+			},
+		},
+		{
+			name:   "invalid character class",
+			source: "S -> 'a'\n   | [z-a]",
+			err:    "Invalid character class '[z-a]': invalid character class range at 2:6",
+		},
+		{
+			name:   "two labels",
+			source: "S -> 'a' @A @B",
+			err:    "Alternative already labeled 'A' at 1:13",
+		},
+		{
+			name:   "annotation in a group",
+			source: "S -> ('a' @A | 'b')",
+			err:    "Labels and annotations are only allowed on the alternatives of rules at 1:6",
+		},
+		{
+			name:   "undefined start",
+			source: "%start T ; S -> 'a'",
+			err:    "Start variable 'T' is not defined",
+		},
+		{
+			name:   "undefined variable",
+			source: "S -> 'a' T\n  | 'b' U",
+			err:    "Undefined variable 'T' at 1:10",
+		},
+		{
+			name:   "empty terminal",
+			source: "S -> 'a'\n   | ''",
+			err:    "Empty terminal, use ε for the empty string at 2:6",
+		},
+		{
+			name:   "unclosed group",
+			source: "S -> ('a' | 'b'",
+			err:    "Unclosed '(' at 1:6",
+		},
+		{
+			name:   "missing arrow",
+			source: "S -> 'a' ;\nT 'b'",
+			err:    "Unexpected ''b'' at 2:3, expected '->'",
+		},
+		{
+			name:   "missing rule",
+			source: "S -> 'a' ; ;",
+			err:    "Unexpected ';' at 1:12, expected a rule",
+		},
+		{
+			name:   "token kind defined as variable",
+			source: "%token A\nS -> A\nA -> 'a'",
+			err:    "Token kind 'A' is also defined as a variable at 1:8",
+		},
+		{
+			name:   "no rules",
+			source: "# nothing",
+			err:    "Grammar has no rules",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ParseGrammar(strings.NewReader(tt.source))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("ParseGrammar() error = %v, wanted %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseGrammar() unexpected error: %v", err)
+			}
+			if len(g.Rules) != len(tt.rules) {
+				t.Fatalf("ParseGrammar() unexpected number of rules %v, wanted %v:\n%s", len(g.Rules), len(tt.rules), g)
+			}
+			for i, rule := range g.Rules {
+				if !reflect.DeepEqual(*rule, tt.rules[i]) {
+					t.Errorf("ParseGrammar() rule %d is %#v, wanted %#v", i, *rule, tt.rules[i])
+				}
+			}
+			if tt.start == "" {
+				tt.start = tt.rules[0].Variable
+			}
+			if g.StartVariable() != tt.start || g.Name != tt.gname {
+				t.Errorf("ParseGrammar() start %q and name %q, wanted %q and %q", g.StartVariable(), g.Name, tt.start, tt.gname)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"slices"
+	"sync"
+	"unicode"
+)
+
+// CharClass is a terminal symbol matching a single character of a class, written
+// as in regular expressions: [0-9], [a-zA-Z_], negated classes like [^"\\],
+// Unicode classes like \p{L}, the Perl classes \d, \w and \s and . for any
+// character but a newline
+type CharClass string
+
+func (c CharClass) String() string {
+	return string(c)
+}
+
+func (CharClass) symbol() {}
+
+// RuneRange is the range of characters from Lo to Hi included
+type RuneRange struct {
+	Lo, Hi rune
+}
+
+// classCache holds the ranges of the classes compiled so far
+var classCache = struct {
+	sync.RWMutex
+	ranges map[CharClass][]RuneRange
+}{ranges: make(map[CharClass][]RuneRange)}
+
+// Ranges returns the sorted, disjoint ranges of characters of the class, an
+// error if it is not a valid class of a single character
+func (c CharClass) Ranges() ([]RuneRange, error) {
+	classCache.RLock()
+	ranges, ok := classCache.ranges[c]
+	classCache.RUnlock()
+	if ok {
+		return ranges, nil
+	}
+
+	re, err := syntax.Parse(string(c), syntax.Perl)
+	if err != nil {
+		msg := err.Error()
+		if syntaxErr := (*syntax.Error)(nil); errors.As(err, &syntaxErr) {
+			msg = syntaxErr.Code.String()
+		}
+		return nil, fmt.Errorf("Invalid character class '%s': %s", c, msg)
+	}
+	switch re = re.Simplify(); {
+	case re.Op == syntax.OpCharClass:
+		for i := 0; i < len(re.Rune); i += 2 {
+			ranges = append(ranges, RuneRange{Lo: re.Rune[i], Hi: re.Rune[i+1]})
+		}
+	case re.Op == syntax.OpLiteral && len(re.Rune) == 1:
+		// A literal ignoring case matches every character of its case folding orbit
+		runes := []rune{re.Rune[0]}
+		if re.Flags&syntax.FoldCase != 0 {
+			for r := unicode.SimpleFold(re.Rune[0]); r != re.Rune[0]; r = unicode.SimpleFold(r) {
+				runes = append(runes, r)
+			}
+			slices.Sort(runes)
+		}
+		for _, r := range runes {
+			ranges = append(ranges, RuneRange{Lo: r, Hi: r})
+		}
+	case re.Op == syntax.OpAnyCharNotNL:
+		ranges = []RuneRange{{Lo: 0, Hi: '\n' - 1}, {Lo: '\n' + 1, Hi: unicode.MaxRune}}
+	case re.Op == syntax.OpAnyChar:
+		ranges = []RuneRange{{Lo: 0, Hi: unicode.MaxRune}}
+	default:
+		return nil, fmt.Errorf("Invalid character class '%s': it does not match a single character", c)
+	}
+
+	classCache.Lock()
+	classCache.ranges[c] = ranges
+	classCache.Unlock()
+	return ranges, nil
+}
+
+// Match reports whether r belongs to the class, false if the class is invalid
+func (c CharClass) Match(r rune) bool {
+	ranges, err := c.Ranges()
+	if err != nil {
+		return false
+	}
+	i, found := slices.BinarySearchFunc(ranges, r, func(rr RuneRange, r rune) int {
+		return int(rr.Lo - r)
+	})
+	return found || (i > 0 && r <= ranges[i-1].Hi)
+}
+
+// Example returns the smallest printable character of the class, false if it
+// has none
+func (c CharClass) Example() (rune, bool) {
+	ranges, _ := c.Ranges()
+	for _, rr := range ranges {
+		for r := rr.Lo; r <= rr.Hi; r++ {
+			if unicode.IsPrint(r) {
+				return r, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Classes returns the character classes used by rules, in order of appearance
+func (g *Grammar) Classes() []CharClass {
+	var classes []CharClass
+	for _, rule := range g.Rules {
+		for _, sym := range rule.Expr {
+			if c, ok := sym.(CharClass); ok && !slices.Contains(classes, c) {
+				classes = append(classes, c)
+			}
+		}
+	}
+	return classes
+}
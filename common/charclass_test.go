@@ -0,0 +1,72 @@
+package common
+
+import "testing"
+
+func TestCharClassMatch(t *testing.T) {
+	tests := []struct {
+		class  CharClass
+		accept string
+		reject string
+	}{
+		{class: "[0-9]", accept: "0459", reject: "a/:٣"},
+		{class: "[a-zA-Z_]", accept: "azAZ_", reject: "09-é"},
+		{class: `[^"\\]`, accept: "a'\n→", reject: `"\`},
+		{class: `\p{L}`, accept: "aZéλ字", reject: "1_ "},
+		{class: `\d`, accept: "07", reject: "a٣"},
+		{class: "[[:upper:]]", accept: "AZ", reject: "aÉ"},
+		{class: "[.]", accept: ".", reject: "a"},
+		{class: ".", accept: "a.\x00\U0010FFFF", reject: "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.class.String(), func(t *testing.T) {
+			for _, r := range tt.accept {
+				if !tt.class.Match(r) {
+					t.Errorf("Match(%q) = false, want true", r)
+				}
+			}
+			for _, r := range tt.reject {
+				if tt.class.Match(r) {
+					t.Errorf("Match(%q) = true, want false", r)
+				}
+			}
+		})
+	}
+}
+
+func TestCharClassRanges(t *testing.T) {
+	tests := []struct {
+		class    CharClass
+		expected []RuneRange
+		err      bool
+	}{
+		{class: "[a-cx]", expected: []RuneRange{{'a', 'c'}, {'x', 'x'}}},
+		{class: "[^\x00-\U0010FFFE]", expected: []RuneRange{{'\U0010FFFF', '\U0010FFFF'}}},
+		{class: "x", expected: []RuneRange{{'x', 'x'}}},
+		{class: "[z-a]", err: true},
+		{class: "ab", err: true},
+		{class: "[0-9]+", err: true},
+		{class: "(?i)k", expected: []RuneRange{{'K', 'K'}, {'k', 'k'}, {'\u212A', '\u212A'}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.class.String(), func(t *testing.T) {
+			ranges, err := tt.class.Ranges()
+			if tt.err {
+				if err == nil {
+					t.Errorf("Ranges() = %v, expected error", ranges)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Ranges() unexpected error: %v", err)
+			}
+			if len(ranges) != len(tt.expected) {
+				t.Fatalf("Ranges() = %v, want %v", ranges, tt.expected)
+			}
+			for i := range ranges {
+				if ranges[i] != tt.expected[i] {
+					t.Errorf("Ranges() = %v, want %v", ranges, tt.expected)
+				}
+			}
+		})
+	}
+}
@@ -4,168 +4,117 @@ import (
 	"fmt"
 )
 
-func _variableRemovalPermutations(expr Expr, variable Variable, offset int) []Expr {
-	var exprs []Expr
-	for i, sym := range expr[offset:] {
-		if v, ok := sym.(RuleRef); ok {
-			if v.Variable == variable {
-				index := offset + i
-				newExpr := make(Expr, len(expr)-1)
-				copy(newExpr, expr[:index])
-				copy(newExpr[index:], expr[index+1:])
-				exprs = append(exprs, newExpr)
-				exprs = append(exprs, _variableRemovalPermutations(newExpr, variable, index)...)
-				exprs = append(exprs, _variableRemovalPermutations(expr, variable, index+1)...)
-				break
-			}
-		}
-	}
-	return exprs
-}
-
-func VariableRemovalPermutations(expr Expr, variable Variable) []Expr {
-	return _variableRemovalPermutations(expr, variable, 0)
+// addStart adds a fresh start variable deriving the old one, so the start never
+// occurs on a right-hand side
+func (g *Grammar) addStart() (*Grammar, error) {
+	used := g.usedVariables()
+	start := freshVariable(&used, "S0")
+	rules := []derivedRule{{
+		Rule:   NewRule(start, Expr{Ref(g.StartVariable())}),
+		origin: spliceOrigin(1),
+	}}
+	return g.derive("add start variable", start, append(rules, g.identityRules()...))
 }
 
-func removeEpsilonProductions(rules *[]Rule) {
-	ruleMap := make(map[Variable][]Rule)
-	for _, rule := range *rules {
-		if _, ok := ruleMap[rule.Variable]; !ok {
-			ruleMap[rule.Variable] = make([]Rule, 0)
+// separateTerminals replaces every terminal in right-hand sides of more than one
+// symbol by a fresh variable deriving only it, except leading terminals if
+// keepFirst is set
+func (g *Grammar) separateTerminals(keepFirst bool) (*Grammar, error) {
+	used := g.usedVariables()
+	termVars := make(map[string]Variable)
+	var termRules []derivedRule
+
+	rules := g.identityRules()
+	for i, rule := range rules {
+		if len(rule.Expr) < 2 {
+			continue
 		}
-		ruleMap[rule.Variable] = append(ruleMap[rule.Variable], rule)
-	}
-	for i, rule := range *rules {
-		if len(rule.Expr) == 0 {
-			*rules = append((*rules)[:i], (*rules)[i+1:]...)
-			targetVar := rule.Variable
-			if len(ruleMap[targetVar]) > 1 {
-				for _, rule := range *rules {
-					for _, expr := range VariableRemovalPermutations(rule.Expr, targetVar) {
-						*rules = append(*rules, Rule{Variable: rule.Variable, Expr: expr})
-					}
-				}
-			} else {
-				for j, rule := range *rules {
-					for i, sym := range rule.Expr {
-						if v, ok := sym.(RuleRef); ok {
-							if v.Variable == targetVar {
-								newExpr := make(Expr, len(rule.Expr)-1)
-								copy(newExpr, rule.Expr[:i])
-								copy(newExpr[i:], rule.Expr[i+1:])
-								(*rules)[j].Expr = newExpr
-							}
-						}
-					}
-				}
+		for j, sym := range rule.Expr {
+			if !isTerminal(sym) || (keepFirst && j == 0) {
+				continue
+			}
+			key := ruleKey(NewRule("", Expr{sym}))
+			v, ok := termVars[key]
+			if !ok {
+				// Named after the terminal as far as the grammar file format allows
+				v = freshVariable(&used, "N"+nonIdentifier.ReplaceAllString(sym.String(), ""))
+				termVars[key] = v
+				termRules = append(termRules, derivedRule{
+					Rule:   NewRule(v, Expr{sym}),
+					origin: spliceOrigin(1),
+				})
 			}
+			rules[i].Expr[j] = Ref(v)
 		}
 	}
+	return g.derive("separate terminals", g.StartVariable(), append(rules, termRules...))
 }
 
-func cnfTransformSymbol(sym Symbol) Variable {
-	switch v := sym.(type) {
-	case string:
-		return Variable("N" + v)
-	case Terminal:
-		return Variable("N" + v.String())
-	case RuleRef:
-		return Variable("_" + v.Variable)
-	case Variable:
-		return Variable("_" + v.String())
-	}
+// binarize splits right-hand sides of more than two symbols into chains of fresh variables
+func (g *Grammar) binarize() (*Grammar, error) {
+	used := g.usedVariables()
+	var rules []derivedRule
+	for i, rule := range g.identityRules() {
+		if len(rule.Expr) <= 2 {
+			rules = append(rules, rule)
+			continue
+		}
 
-	return "INVALID SYMBOL"
+		// A -> X1 X2 X3... becomes A -> X1 Ai2, Ai2 -> X2 Ai3...
+		v := rule.Variable
+		for j := 1; j < len(rule.Expr)-1; j++ {
+			next := freshVariable(&used, fmt.Sprintf("A%d%d", i, j+1))
+			head := derivedRule{
+				Rule:   NewRule(v, Expr{rule.Expr[j-1], Ref(next)}),
+				origin: spliceOrigin(2),
+			}
+			// The first of the chain stands for the rule
+			if j == 1 {
+				head.Rule = rule.derived(v, head.Expr)
+				head.origin = []template{tApply{rule: i, args: head.origin}}
+			}
+			rules = append(rules, head)
+			v = next
+		}
+		rules = append(rules, derivedRule{
+			Rule:   NewRule(v, rule.Expr[len(rule.Expr)-2:]),
+			origin: spliceOrigin(2),
+		})
+	}
+	return g.derive("binarize", g.StartVariable(), rules)
 }
 
 // ToCNF converts a Grammar to an equivalent Grammar in Chomsky Normal Form
 // Based off of the algorithm described here: https://en.wikipedia.org/wiki/Chomsky_normal_form#Converting_a_grammar_to_Chomsky_normal_form
+// Every step is a transformation of the previous one, parse trees of the result
+// can be folded back into parse trees of g with FoldTo.
 func (g *Grammar) ToCNF() (*Grammar, error) {
-	var rules []Rule
-
 	// START: Eliminate the start symbol from right-hand sides
-	// S0 -> _S
-	rules = append(rules, NewRule("S0", Expr{Ref(cnfTransformSymbol(g.StartVariable()))}))
+	h, err := g.addStart()
+	if err != nil {
+		return nil, err
+	}
 
 	// TERM: Eliminate rules with nonsolitary terminals
-	for _, term := range g.Terminals.Data {
-		rules = append(rules, NewRule(cnfTransformSymbol(term), Expr{term}))
+	if h, err = h.separateTerminals(false); err != nil {
+		return nil, err
 	}
 
 	// BIN: Eliminate right-hand sides with more than 2 nonterminals
-	for i, rule := range g.Rules {
-		// A -> X1 X2 X3... becomes _A -> _X1 _X2 _X3...
-		r := rule.Copy()
-		r.Variable = cnfTransformSymbol(rule.Variable)
-
-		// I love Go type system :)
-		expr := make([]RuleRef, len(r.Expr))
-		for i, sym := range r.Expr {
-			expr[i] = Ref(cnfTransformSymbol(sym))
-			r.Expr[i] = expr[i]
-		}
-
-		if len(r.Expr) > 2 {
-			for j := 1; j < len(expr); j++ {
-				var ruleVar Variable
-				var endSymbol Variable
-				if j == len(r.Expr)-1 {
-					endSymbol = expr[j].Variable
-				} else {
-					endSymbol = Variable(fmt.Sprintf("A%d%d", i, j+1))
-				}
-
-				if j == 1 {
-					ruleVar = r.Variable
-				} else {
-					ruleVar = Variable(fmt.Sprintf("A%d%d", i, j))
-				}
-
-				rule := Rule{
-					Variable: ruleVar,
-					Expr: Expr{
-						expr[j-1],
-						Ref(endSymbol),
-					},
-				}
-
-				rules = append(rules, rule)
-			}
-		} else {
-			rules = append(rules, r)
-		}
+	if h, err = h.binarize(); err != nil {
+		return nil, err
 	}
 
 	// DEL: Eliminate ε-rules
-	removeEpsilonProductions(&rules)
-
-	for _, rule := range rules {
-		fmt.Println(rule.String())
+	if h, err = h.removeEpsilon(true); err != nil {
+		return nil, err
 	}
 
 	// UNIT: Eliminate unit rules
-	var removeIndices []int
-	for i := 0; i < len(rules); i++ {
-		rule := rules[i]
-		if len(rule.Expr) != 1 {
-			continue
-		}
-		lhsVar := rule.Variable
-		if v, ok := rule.Expr[0].(RuleRef); ok {
-			removeIndices = append(removeIndices, i)
-			for _, rule := range rules {
-				if rule.Variable == v.Variable {
-					newExpr := make(Expr, len(rule.Expr))
-					copy(newExpr, rule.Expr)
-					rules = append(rules, Rule{Variable: lhsVar, Expr: newExpr})
-				}
-			}
-		}
-	}
-	fmt.Println(removeIndices)
-	for i, index := range removeIndices {
-		rules = append(rules[:index-i], rules[index-i+1:]...)
+	if h, err = h.RemoveUnit(); err != nil {
+		return nil, err
 	}
 
-	return NewGrammar(rules)
+	// Variables only used by removed rules are left behind
+	return h.RemoveUseless()
 }
@@ -0,0 +1,146 @@
+package common
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestToCNF(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		empty bool
+	}{
+		{
+			name: "palindromes",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Ref("S"), Literal("a")}),
+				NewRule("S", Expr{Literal("b"), Ref("S"), Literal("b")}),
+				NewRule("S", Expr{}),
+				NewRule("S", Expr{Literal("a")}),
+				NewRule("S", Expr{Literal("b")}),
+			},
+			empty: true,
+		},
+		{
+			name: "unit cycle",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A")}),
+				NewRule("A", Expr{Ref("S")}),
+				NewRule("A", Expr{Literal("a"), Ref("B"), Literal("c"), Ref("B")}),
+				NewRule("B", Expr{Literal("b")}),
+				NewRule("B", Expr{}),
+			},
+			empty: false,
+		},
+		{
+			name: "name collisions",
+			rules: []Rule{
+				NewRule("S0", Expr{Ref("Na"), Literal("a"), Ref("S0")}),
+				NewRule("S0", Expr{Literal("b")}),
+				NewRule("Na", Expr{Literal("a")}),
+			},
+			empty: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			cnf, err := g.ToCNF()
+			if err != nil {
+				t.Fatalf("ToCNF() unexpected error: %v", err)
+			}
+			start := cnf.StartVariable()
+			empty := false
+			for _, rule := range cnf.Rules {
+				switch len(rule.Expr) {
+				case 0:
+					if rule.Variable != start {
+						t.Errorf("ToCNF() produced ε-rule for non-start variable: %s", rule.String())
+					}
+					empty = true
+				case 1:
+					if !isTerminal(rule.Expr[0]) {
+						t.Errorf("ToCNF() produced unit rule: %s", rule.String())
+					}
+				case 2:
+					for _, sym := range rule.Expr {
+						if ref, ok := sym.(RuleRef); !ok || ref.Variable == start {
+							t.Errorf("ToCNF() produced invalid binary rule: %s", rule.String())
+						}
+					}
+				default:
+					t.Errorf("ToCNF() produced long rule: %s", rule.String())
+				}
+			}
+			if empty != tt.empty {
+				t.Errorf("ToCNF() derives ε = %v, want %v", empty, tt.empty)
+			}
+			if cnf.Original() != g {
+				t.Errorf("Original() does not return the source grammar")
+			}
+		})
+	}
+}
+
+func TestFoldCNF(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("S", Expr{Literal("a"), Ref("B"), Ref("B"), Literal("c")}),
+		NewRule("B", Expr{Literal("b")}),
+		NewRule("B", Expr{}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	cnf, err := g.ToCNF()
+	if err != nil {
+		t.Fatalf("ToCNF() unexpected error: %v", err)
+	}
+
+	// Derive "abc" in the CNF grammar by hand: S0 -> Na X, X -> B Nc, where X
+	// stands for the second half of 'a' B B 'c' with the first B omitted
+	rule := func(v Variable, expr ...Symbol) int {
+		key := ruleKey(NewRule(v, expr))
+		for i, r := range cnf.Rules {
+			if ruleKey(*r) == key {
+				return i
+			}
+		}
+		t.Fatalf("CNF grammar has no rule %s -> %v", v, expr)
+		return -1
+	}
+	var x Variable
+	for _, r := range cnf.Rules {
+		if r.Variable == cnf.StartVariable() && len(r.Expr) == 2 {
+			x = r.Expr[1].(RuleRef).Variable
+			if len(cnf.RulesMap[x]) == 2 {
+				break
+			}
+		}
+	}
+	na := cnf.Rules[rule(cnf.StartVariable(), Ref("Na"), Ref(x))].Expr[0].(RuleRef).Variable
+	tree := &ParseTree{Rule: rule(cnf.StartVariable(), Ref(na), Ref(x)), Variable: cnf.StartVariable(), Children: []*ParseTree{
+		{Rule: rule(na, Literal("a")), Variable: na, Children: []*ParseTree{NewLeaf(Literal("a"), Span{0, 1})}},
+		{Rule: rule(x, Ref("B"), Ref("Nc")), Variable: x, Children: []*ParseTree{
+			{Rule: rule("B", Literal("b")), Variable: "B", Children: []*ParseTree{NewLeaf(Literal("b"), Span{1, 2})}},
+			{Rule: rule("Nc", Literal("c")), Variable: "Nc", Children: []*ParseTree{NewLeaf(Literal("c"), Span{2, 3})}},
+		}},
+	}}
+
+	folded, err := cnf.FoldTo(tree, g)
+	if err != nil {
+		t.Fatalf("FoldTo() unexpected error: %v", err)
+	}
+	leftParse := folded.LeftParse()
+	expected := []int{0, 2, 1}
+	if !slices.Equal(leftParse, expected) {
+		t.Fatalf("FoldTo() left parse = %v, want %v", leftParse, expected)
+	}
+	if folded.Span != (Span{0, 3}) || folded.Children[1].Span != (Span{1, 1}) {
+		t.Errorf("FoldTo() unexpected spans %v", folded)
+	}
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DescribeTerminal returns a terminal quoted for error messages
+func DescribeTerminal(t Terminal) string {
+	if t == EndOfInput {
+		return "end of input"
+	}
+	return "'" + t.String() + "'"
+}
+
+// ParseError is the error of a parser rejecting its input, located at the
+// furthest position the parser reached
+type ParseError struct {
+	// Offset is the byte offset of the position in the input
+	Offset int
+	// Line and Column locate Offset when the input is known, 0 otherwise
+	Line   int
+	Column int
+	// Found is the text at the position, empty at the end of input
+	Found string
+	AtEnd bool
+	// Expected holds the terminals the parser would have accepted at the position
+	Expected []Terminal
+	// Context lists the variables being recognised at the position, outermost first
+	Context []Variable
+}
+
+func (e *ParseError) Error() string {
+	names := make([]string, len(e.Expected))
+	for j, t := range e.Expected {
+		names[j] = DescribeTerminal(t)
+	}
+	want := "nothing"
+	if len(names) == 1 {
+		want = names[0]
+	} else if len(names) > 1 {
+		want = "one of " + strings.Join(names, ", ")
+	}
+
+	found := e.Found
+	if r, size := utf8.DecodeRuneInString(found); size == len(found) && !unicode.IsGraphic(r) {
+		found = strings.Trim(strconv.QuoteRune(r), "'")
+	}
+	var msg string
+	switch {
+	case e.AtEnd && e.Line == 0:
+		msg = fmt.Sprintf("Unexpected end of input, expected %s", want)
+	case e.AtEnd:
+		msg = fmt.Sprintf("Unexpected end of input at %d:%d, expected %s", e.Line, e.Column, want)
+	case e.Line == 0:
+		msg = fmt.Sprintf("Unexpected '%s' at offset %d, expected %s", found, e.Offset, want)
+	default:
+		msg = fmt.Sprintf("Unexpected '%s' at %d:%d, expected %s", found, e.Line, e.Column, want)
+	}
+	if len(e.Context) > 0 {
+		context := make([]string, len(e.Context))
+		for j, v := range e.Context {
+			context[j] = v.String()
+		}
+		msg += " while parsing " + strings.Join(context, " > ")
+	}
+	return msg
+}
+
+// UnexpectedToken returns the error of a parser expecting one of the expected
+// terminals at token i
+func UnexpectedToken(tokens []Token, i int, expected []Terminal) *ParseError {
+	if i >= len(tokens) {
+		err := &ParseError{AtEnd: true, Expected: expected}
+		if len(tokens) > 0 {
+			err.Offset = tokens[len(tokens)-1].Span.End
+		}
+		return err
+	}
+	return &ParseError{Offset: tokens[i].Span.Start, Found: tokens[i].Lexeme, Expected: expected}
+}
+
+// UnexpectedInput returns the error of a parser expecting one of the expected
+// terminals at a byte offset of raw input, the character there being unexpected
+func UnexpectedInput(input string, offset int, expected []Terminal) *ParseError {
+	err := &ParseError{Offset: offset, Expected: expected, AtEnd: offset >= len(input)}
+	if !err.AtEnd {
+		r, _ := utf8.DecodeRuneInString(input[offset:])
+		err.Found = string(r)
+	}
+	err.Line, err.Column = LineColumn(input, offset)
+	return err
+}
@@ -0,0 +1,104 @@
+package common
+
+// EndOfInput is the lookahead terminal marking the end of the input in FOLLOW sets
+const EndOfInput Terminal = ""
+
+// FirstFollow holds the nullable variables of a grammar and their FIRST and FOLLOW sets
+type FirstFollow struct {
+	Nullable map[Variable]bool
+	First    map[Variable]*OrderedSet[Terminal]
+	Follow   map[Variable]*OrderedSet[Terminal]
+}
+
+// TerminalOf returns the terminal a symbol stands for, false if it is a RuleRef.
+// A CharClass stands for the terminal of its notation, so FIRST and FOLLOW sets
+// hold classes rather than the characters they match.
+func TerminalOf(sym Symbol) (Terminal, bool) {
+	switch v := sym.(type) {
+	case Literal:
+		return Terminal(v), true
+	case Terminal:
+		return v, true
+	case CharClass:
+		return Terminal(v), true
+	}
+	return "", false
+}
+
+// FirstFollow computes the nullable variables and the FIRST and FOLLOW sets of g
+func (g *Grammar) FirstFollow() *FirstFollow {
+	sets := &FirstFollow{
+		Nullable: make(map[Variable]bool),
+		First:    make(map[Variable]*OrderedSet[Terminal]),
+		Follow:   make(map[Variable]*OrderedSet[Terminal]),
+	}
+	for _, v := range g.Variables.Data {
+		first := NewOrderedSet[Terminal]()
+		follow := NewOrderedSet[Terminal]()
+		sets.First[v] = &first
+		sets.Follow[v] = &follow
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range g.Rules {
+			first, nullable := sets.FirstOf(rule.Expr)
+			for _, t := range first.Data {
+				if sets.First[rule.Variable].Insert(t) {
+					changed = true
+				}
+			}
+			if nullable && !sets.Nullable[rule.Variable] {
+				sets.Nullable[rule.Variable] = true
+				changed = true
+			}
+		}
+	}
+
+	sets.Follow[g.StartVariable()].Insert(EndOfInput)
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range g.Rules {
+			for i, sym := range rule.Expr {
+				ref, ok := sym.(RuleRef)
+				if !ok {
+					continue
+				}
+				first, nullable := sets.FirstOf(rule.Expr[i+1:])
+				for _, t := range first.Data {
+					if sets.Follow[ref.Variable].Insert(t) {
+						changed = true
+					}
+				}
+				if !nullable {
+					continue
+				}
+				for _, t := range sets.Follow[rule.Variable].Data {
+					if sets.Follow[ref.Variable].Insert(t) {
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return sets
+}
+
+// FirstOf returns the FIRST set of a sequence of symbols and whether it is nullable
+func (s *FirstFollow) FirstOf(expr Expr) (OrderedSet[Terminal], bool) {
+	first := NewOrderedSet[Terminal]()
+	for _, sym := range expr {
+		if t, ok := TerminalOf(sym); ok {
+			first.Insert(t)
+			return first, false
+		}
+		v := sym.(RuleRef).Variable
+		for _, t := range s.First[v].Data {
+			first.Insert(t)
+		}
+		if !s.Nullable[v] {
+			return first, false
+		}
+	}
+	return first, true
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFirstFollow(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("E", Expr{Ref("T"), Ref("E'")}),
+		NewRule("E'", Expr{Literal("+"), Ref("T"), Ref("E'")}),
+		NewRule("E'", Expr{}),
+		NewRule("T", Expr{Ref("F"), Ref("T'")}),
+		NewRule("T'", Expr{Literal("*"), Ref("F"), Ref("T'")}),
+		NewRule("T'", Expr{}),
+		NewRule("F", Expr{Literal("("), Ref("E"), Literal(")")}),
+		NewRule("F", Expr{Terminal("id")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	sets := g.FirstFollow()
+
+	tests := []struct {
+		variable Variable
+		nullable bool
+		first    []Terminal
+		follow   []Terminal
+	}{
+		{"E", false, []Terminal{"(", "id"}, []Terminal{EndOfInput, ")"}},
+		{"E'", true, []Terminal{"+"}, []Terminal{EndOfInput, ")"}},
+		{"T", false, []Terminal{"(", "id"}, []Terminal{EndOfInput, ")", "+"}},
+		{"T'", true, []Terminal{"*"}, []Terminal{EndOfInput, ")", "+"}},
+		{"F", false, []Terminal{"(", "id"}, []Terminal{EndOfInput, ")", "*", "+"}},
+	}
+	for _, tt := range tests {
+		if sets.Nullable[tt.variable] != tt.nullable {
+			t.Errorf("Nullable[%s] = %v, want %v", tt.variable, sets.Nullable[tt.variable], tt.nullable)
+		}
+		if first := slices.Sorted(slices.Values(sets.First[tt.variable].Data)); !slices.Equal(first, tt.first) {
+			t.Errorf("First[%s] = %q, want %q", tt.variable, first, tt.first)
+		}
+		if follow := slices.Sorted(slices.Values(sets.Follow[tt.variable].Data)); !slices.Equal(follow, tt.follow) {
+			t.Errorf("Follow[%s] = %q, want %q", tt.variable, follow, tt.follow)
+		}
+	}
+
+	first, nullable := sets.FirstOf(Expr{Ref("T'"), Ref("E'")})
+	if !nullable || !slices.Equal(slices.Sorted(slices.Values(first.Data)), []Terminal{"*", "+"}) {
+		t.Errorf("FirstOf(T' E') = %q, %v", first.Data, nullable)
+	}
+}
+
+func TestFirstFollowClasses(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("Item", Expr{Ref("Ident")}),
+		NewRule("Item", Expr{Literal("-"), Ref("Number")}),
+		NewRule("Ident", Expr{CharClass(`\p{L}`), Ref("Rest")}),
+		NewRule("Rest", Expr{CharClass(`[\p{L}0-9]`), Ref("Rest")}),
+		NewRule("Rest", Expr{}),
+		NewRule("Number", Expr{CharClass("[0-9]"), Ref("Number")}),
+		NewRule("Number", Expr{CharClass("[0-9]")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	sets := g.FirstFollow()
+
+	tests := []struct {
+		variable Variable
+		first    []Terminal
+		follow   []Terminal
+	}{
+		{"Item", []Terminal{"-", `\p{L}`}, []Terminal{EndOfInput}},
+		{"Rest", []Terminal{`[\p{L}0-9]`}, []Terminal{EndOfInput}},
+		{"Number", []Terminal{"[0-9]"}, []Terminal{EndOfInput}},
+	}
+	for _, tt := range tests {
+		if first := slices.Sorted(slices.Values(sets.First[tt.variable].Data)); !slices.Equal(first, tt.first) {
+			t.Errorf("First[%s] = %q, want %q", tt.variable, first, tt.first)
+		}
+		if follow := slices.Sorted(slices.Values(sets.Follow[tt.variable].Data)); !slices.Equal(follow, tt.follow) {
+			t.Errorf("Follow[%s] = %q, want %q", tt.variable, follow, tt.follow)
+		}
+	}
+	if classes := g.Classes(); !slices.Equal(classes, []CharClass{`\p{L}`, `[\p{L}0-9]`, "[0-9]"}) {
+		t.Errorf("Classes() = %q", classes)
+	}
+}
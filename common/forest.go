@@ -0,0 +1,301 @@
+package common
+
+import (
+	"errors"
+	"iter"
+	"math/big"
+)
+
+// ErrInfiniteDerivations is returned when counting the derivations of a cyclic forest
+var ErrInfiniteDerivations = errors.New("Forest contains infinitely many derivations")
+
+// ForestNode is a node of a binarised shared packed parse forest (SPPF).
+// Symbol nodes derive a variable or match a terminal over a span, intermediate
+// nodes derive the first Dot symbols of a rule over a span. Each way of
+// deriving a node is one of its packed nodes.
+type ForestNode struct {
+	// Variable is derived by variable symbol nodes
+	Variable Variable
+	// Terminal is matched by terminal symbol nodes
+	Terminal Symbol
+	// Rule is the rule of an intermediate node, -1 for symbol nodes
+	Rule   int
+	Dot    int
+	Span   Span
+	Packed []*PackedNode
+}
+
+// PackedNode is one derivation of its parent, splitting it into the node
+// deriving all but the last symbol (nil if there are none) and the node of the
+// last symbol (nil for ε-rules)
+type PackedNode struct {
+	Rule  int
+	Left  *ForestNode
+	Right *ForestNode
+}
+
+// IsTerminal returns whether the node is a terminal symbol node
+func (n *ForestNode) IsTerminal() bool {
+	return n.Terminal != nil
+}
+
+// IsIntermediate returns whether the node is an intermediate node
+func (n *ForestNode) IsIntermediate() bool {
+	return n.Rule >= 0
+}
+
+// Forest is a shared packed parse forest holding every derivation of an input
+type Forest struct {
+	Root *ForestNode
+}
+
+// IsAmbiguous returns whether the input has more than one derivation
+func (f *Forest) IsAmbiguous() bool {
+	ambiguous := false
+	f.walk(func(node *ForestNode) {
+		if len(node.Packed) > 1 {
+			ambiguous = true
+		}
+	})
+	return ambiguous
+}
+
+// Count returns the number of derivations, or ErrInfiniteDerivations if the
+// forest is cyclic
+func (f *Forest) Count() (*big.Int, error) {
+	counts := make(map[*ForestNode]*big.Int)
+	onStack := make(map[*ForestNode]bool)
+
+	var count func(node *ForestNode) (*big.Int, error)
+	count = func(node *ForestNode) (*big.Int, error) {
+		if node == nil || node.IsTerminal() {
+			return big.NewInt(1), nil
+		}
+		if c, ok := counts[node]; ok {
+			return c, nil
+		}
+		if onStack[node] {
+			return nil, ErrInfiniteDerivations
+		}
+		onStack[node] = true
+		total := big.NewInt(0)
+		for _, packed := range node.Packed {
+			left, err := count(packed.Left)
+			if err != nil {
+				return nil, err
+			}
+			right, err := count(packed.Right)
+			if err != nil {
+				return nil, err
+			}
+			total.Add(total, new(big.Int).Mul(left, right))
+		}
+		onStack[node] = false
+		counts[node] = total
+		return total, nil
+	}
+	return count(f.Root)
+}
+
+// Tree returns a derivation of minimal height
+func (f *Forest) Tree() *ParseTree {
+	// Compute the height of the shortest derivation of every node until it
+	// stabilises, cycles are never part of a shortest derivation
+	nodes := f.postOrder()
+	height := make(map[*ForestNode]int, len(nodes))
+	best := make(map[*ForestNode]*PackedNode, len(nodes))
+	heightOf := func(node *ForestNode) (int, bool) {
+		if node == nil {
+			return 0, true
+		}
+		h, ok := height[node]
+		return h, ok
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, node := range nodes {
+			if node.IsTerminal() {
+				if _, ok := height[node]; !ok {
+					height[node] = 0
+					changed = true
+				}
+				continue
+			}
+			for _, packed := range node.Packed {
+				left, okLeft := heightOf(packed.Left)
+				right, okRight := heightOf(packed.Right)
+				if !okLeft || !okRight {
+					continue
+				}
+				h := 1 + max(left, right)
+				if cur, ok := height[node]; !ok || h < cur {
+					height[node] = h
+					best[node] = packed
+					changed = true
+				}
+			}
+		}
+	}
+
+	var children func(node *ForestNode) []*ParseTree
+	var tree func(node *ForestNode) *ParseTree
+	children = func(node *ForestNode) []*ParseTree {
+		if node == nil {
+			return nil
+		}
+		packed := best[node]
+		return append(children(packed.Left), tree(packed.Right))
+	}
+	tree = func(node *ForestNode) *ParseTree {
+		if node.IsTerminal() {
+			return NewLeaf(node.Terminal, node.Span)
+		}
+		packed := best[node]
+		t := &ParseTree{
+			Rule:     packed.Rule,
+			Variable: node.Variable,
+			Span:     node.Span,
+			Children: children(packed.Left),
+		}
+		if packed.Right != nil {
+			t.Children = append(t.Children, tree(packed.Right))
+		}
+		return t
+	}
+	if _, ok := best[f.Root]; !ok {
+		return nil
+	}
+	return tree(f.Root)
+}
+
+// Trees lazily enumerates every derivation without cycles
+func (f *Forest) Trees() iter.Seq[*ParseTree] {
+	return func(yield func(*ParseTree) bool) {
+		for tree := range trees(f.Root, nil) {
+			if !yield(tree) {
+				return
+			}
+		}
+	}
+}
+
+// forestPath is the chain of symbol nodes above the node being enumerated
+type forestPath struct {
+	node   *ForestNode
+	parent *forestPath
+}
+
+func (p *forestPath) contains(node *ForestNode) bool {
+	for ; p != nil; p = p.parent {
+		if p.node == node {
+			return true
+		}
+	}
+	return false
+}
+
+func trees(node *ForestNode, path *forestPath) iter.Seq[*ParseTree] {
+	return func(yield func(*ParseTree) bool) {
+		if node.IsTerminal() {
+			yield(NewLeaf(node.Terminal, node.Span))
+			return
+		}
+		if path.contains(node) {
+			return
+		}
+		path = &forestPath{node: node, parent: path}
+		for _, packed := range node.Packed {
+			for children := range packedChildren(packed, path) {
+				tree := &ParseTree{
+					Rule:     packed.Rule,
+					Variable: node.Variable,
+					Span:     node.Span,
+					Children: children,
+				}
+				if !yield(tree) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// packedChildren enumerates the lists of subtrees a packed node derives
+func packedChildren(packed *PackedNode, path *forestPath) iter.Seq[[]*ParseTree] {
+	return func(yield func([]*ParseTree) bool) {
+		for left := range prefixChildren(packed.Left, path) {
+			if packed.Right == nil {
+				if !yield(left) {
+					return
+				}
+				continue
+			}
+			for right := range trees(packed.Right, path) {
+				children := make([]*ParseTree, len(left), len(left)+1)
+				copy(children, left)
+				if !yield(append(children, right)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func prefixChildren(node *ForestNode, path *forestPath) iter.Seq[[]*ParseTree] {
+	return func(yield func([]*ParseTree) bool) {
+		if node == nil {
+			yield([]*ParseTree{})
+			return
+		}
+		for _, packed := range node.Packed {
+			for children := range packedChildren(packed, path) {
+				if !yield(children) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// walk visits every node reachable from the root once, parents before children
+func (f *Forest) walk(fn func(node *ForestNode)) {
+	if f.Root == nil {
+		return
+	}
+	visited := map[*ForestNode]bool{f.Root: true}
+	queue := []*ForestNode{f.Root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		fn(node)
+		for _, packed := range node.Packed {
+			for _, child := range []*ForestNode{packed.Left, packed.Right} {
+				if child != nil && !visited[child] {
+					visited[child] = true
+					queue = append(queue, child)
+				}
+			}
+		}
+	}
+}
+
+// postOrder returns every node reachable from the root, children before parents
+// unless they are part of a cycle
+func (f *Forest) postOrder() []*ForestNode {
+	nodes := make([]*ForestNode, 0)
+	visited := make(map[*ForestNode]bool)
+	var visit func(node *ForestNode)
+	visit = func(node *ForestNode) {
+		if node == nil || visited[node] {
+			return
+		}
+		visited[node] = true
+		for _, packed := range node.Packed {
+			visit(packed.Left)
+			visit(packed.Right)
+		}
+		nodes = append(nodes, node)
+	}
+	visit(f.Root)
+	return nodes
+}
@@ -0,0 +1,420 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Sentence is a sentence derived by a Generator
+type Sentence struct {
+	// Words holds the terminals of the sentence in order: literals, token kinds
+	// and the characters drawn for character classes
+	Words []string
+	// LeftParse holds the rules of the leftmost derivation of the sentence, nil
+	// unless the generator was created WithLeftParse
+	LeftParse []int
+}
+
+// String returns the words concatenated, the input the sentence stands for when
+// terminals are matched literally
+func (s Sentence) String() string {
+	return strings.Join(s.Words, "")
+}
+
+// Tokens returns the words as tokens of the kinds they stand for, spanning the
+// input returned by String
+func (s Sentence) Tokens() []Token {
+	tokens := make([]Token, len(s.Words))
+	offset := 0
+	for i, word := range s.Words {
+		tokens[i] = Token{Kind: Terminal(word), Lexeme: word, Span: Span{Start: offset, End: offset + len(word)}}
+		offset += len(word)
+	}
+	return tokens
+}
+
+// Generator derives random sentences of a grammar. Each variable is rewritten by
+// one of the rules that can still end the derivation within the maximum depth,
+// the height of the derivation tree, chosen in proportion to their weights.
+// Given a target length, sentences are drawn among the derivations of that
+// length instead, each with a probability proportional to the product of the
+// weights of its rules. A Generator is not safe for concurrent use.
+type Generator struct {
+	gram *Grammar
+	rng  *rand.Rand
+	// weights holds the weight of each rule, given by the "weight" annotation
+	// of the rule or WithWeight, 1 by default
+	weights []float64
+	// rules holds the rules of each variable
+	rules map[Variable][]int
+	// minDepth holds the least height of a derivation tree of each productive
+	// variable, ruleDepth that of a tree whose root applies each rule
+	minDepth  map[Variable]int
+	ruleDepth []int
+	maxDepth  int
+	// length is the target number of terminals, -1 if there is none, target the
+	// number of terminals of the sentences actually drawn
+	length    int
+	target    int
+	leftParse bool
+	// counts holds by depth d the weighted number of derivations of each
+	// variable of height at most d, by number of terminals up to target
+	counts []map[Variable][]float64
+}
+
+// GeneratorOption configures a Generator created by NewGenerator
+type GeneratorOption func(gen *Generator) error
+
+// WithSeed seeds the random number generator, so that generators created with
+// the same seed derive the same sentences. A random seed is used otherwise.
+func WithSeed(seed uint64) GeneratorOption {
+	return func(gen *Generator) error {
+		gen.rng = rand.New(rand.NewPCG(seed, seed))
+		return nil
+	}
+}
+
+// WithMaxDepth bounds the height of derivation trees, 10 more than the least
+// height of a derivation of the start variable by default, and twice the target
+// length more with WithLength
+func WithMaxDepth(depth int) GeneratorOption {
+	return func(gen *Generator) error {
+		if depth < 1 {
+			return fmt.Errorf("Maximum depth must be positive, got %d", depth)
+		}
+		gen.maxDepth = depth
+		return nil
+	}
+}
+
+// WithLength targets sentences of n terminals, or of the closest shorter
+// length the grammar derives within the maximum depth
+func WithLength(n int) GeneratorOption {
+	return func(gen *Generator) error {
+		if n < 0 {
+			return fmt.Errorf("Target length must not be negative, got %d", n)
+		}
+		gen.length = n
+		return nil
+	}
+}
+
+// WithWeight sets the weight of the rule numbered rule, the alternatives of a
+// variable being chosen in proportion to their weights
+func WithWeight(rule int, weight float64) GeneratorOption {
+	return func(gen *Generator) error {
+		if rule < 0 || rule >= len(gen.weights) {
+			return fmt.Errorf("Cannot weight rule '%d', the grammar has %d rules", rule, len(gen.weights))
+		}
+		if !positiveFinite(weight) {
+			return fmt.Errorf("Weight of rule %d must be a positive number, got %v", rule, weight)
+		}
+		gen.weights[rule] = weight
+		return nil
+	}
+}
+
+// WithLeftParse records the left parse of every sentence, to be checked against
+// the output of parsers, or EvalLeftParse for grammars without character classes
+func WithLeftParse() GeneratorOption {
+	return func(gen *Generator) error {
+		gen.leftParse = true
+		return nil
+	}
+}
+
+// NewGenerator returns a generator of random sentences of g, an error if it
+// derives none within the maximum depth and target length
+func NewGenerator(g *Grammar, opts ...GeneratorOption) (*Generator, error) {
+	gen := &Generator{
+		gram:     g,
+		weights:  make([]float64, len(g.Rules)),
+		rules:    make(map[Variable][]int),
+		maxDepth: -1,
+		length:   -1,
+	}
+	for i, rule := range g.Rules {
+		gen.weights[i] = 1
+		if w, ok := rule.Annotations["weight"]; ok {
+			weight, err := strconv.ParseFloat(w, 64)
+			if err != nil || !positiveFinite(weight) {
+				return nil, fmt.Errorf("Rule %d has an invalid weight '%s', weights are positive numbers", i, w)
+			}
+			gen.weights[i] = weight
+		}
+		gen.rules[rule.Variable] = append(gen.rules[rule.Variable], i)
+	}
+	gen.minDepth, gen.ruleDepth = g.minDepths()
+	least, ok := gen.minDepth[g.StartVariable()]
+	if !ok {
+		return nil, errors.New("Grammar derives no strings")
+	}
+	for _, opt := range opts {
+		if err := opt(gen); err != nil {
+			return nil, err
+		}
+	}
+	if gen.rng == nil {
+		gen.rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	if gen.maxDepth < 0 {
+		gen.maxDepth = least + 10 + 2*max(gen.length, 0)
+	}
+	if gen.maxDepth < least {
+		return nil, fmt.Errorf("Start variable '%s' derives no sentence within depth %d, the least depth is %d", g.StartVariable(), gen.maxDepth, least)
+	}
+	if gen.length >= 0 {
+		if err := gen.count(); err != nil {
+			return nil, err
+		}
+	}
+	return gen, nil
+}
+
+// minDepths returns the least height of a derivation tree of each productive
+// variable, and for each rule that of a tree whose root applies it, MaxInt if
+// the rule derives no string
+func (g *Grammar) minDepths() (map[Variable]int, []int) {
+	minDepth := make(map[Variable]int)
+	ruleDepth := make([]int, len(g.Rules))
+	for changed := true; changed; {
+		changed = false
+		for i, rule := range g.Rules {
+			depth := 1
+			for _, sym := range rule.Expr {
+				if ref, ok := sym.(RuleRef); ok {
+					d, ok := minDepth[ref.Variable]
+					if !ok {
+						depth = math.MaxInt
+						break
+					}
+					depth = max(depth, d+1)
+				}
+			}
+			ruleDepth[i] = depth
+			if d, ok := minDepth[rule.Variable]; depth < math.MaxInt && (!ok || depth < d) {
+				minDepth[rule.Variable] = depth
+				changed = true
+			}
+		}
+	}
+	return minDepth, ruleDepth
+}
+
+// count fills the derivation counts up to the target length and picks the
+// length of the sentences drawn
+func (gen *Generator) count() error {
+	g := gen.gram
+	gen.counts = make([]map[Variable][]float64, gen.maxDepth+1)
+	gen.counts[0] = make(map[Variable][]float64, len(g.Variables.Data))
+	for _, v := range g.Variables.Data {
+		gen.counts[0][v] = make([]float64, gen.length+1)
+	}
+	for d := 1; d <= gen.maxDepth; d++ {
+		gen.counts[d] = make(map[Variable][]float64, len(g.Variables.Data))
+		for _, v := range g.Variables.Data {
+			counts := make([]float64, gen.length+1)
+			for _, r := range gen.rules[v] {
+				if gen.ruleDepth[r] > d {
+					continue
+				}
+				derivations := gen.suffixCounts(g.Rules[r].Expr, d-1, gen.length)[0]
+				for n, c := range derivations {
+					counts[n] += gen.weights[r] * c
+				}
+			}
+			gen.counts[d][v] = counts
+		}
+	}
+
+	counts := gen.counts[gen.maxDepth][g.StartVariable()]
+	for gen.target = gen.length; gen.target >= 0 && counts[gen.target] == 0; gen.target-- {
+	}
+	if gen.target < 0 {
+		return fmt.Errorf("Grammar derives no sentence of at most %d terminals within depth %d", gen.length, gen.maxDepth)
+	}
+	if !positiveFinite(counts[gen.target]) {
+		return fmt.Errorf("Grammar has too many derivations of %d terminals, lower the target length or the maximum depth", gen.target)
+	}
+	return nil
+}
+
+// suffixCounts returns for each i the weighted number of derivations of expr[i:]
+// by number of terminals up to n, its variables deriving trees of height at most d
+func (gen *Generator) suffixCounts(expr Expr, d, n int) [][]float64 {
+	suffixes := make([][]float64, len(expr)+1)
+	suffixes[len(expr)] = make([]float64, n+1)
+	suffixes[len(expr)][0] = 1
+	for i := len(expr) - 1; i >= 0; i-- {
+		rest := suffixes[i+1]
+		counts := make([]float64, n+1)
+		if ref, ok := expr[i].(RuleRef); ok {
+			for l, c := range gen.counts[d][ref.Variable] {
+				for m := 0; l+m <= n && c > 0; m++ {
+					// Counts overflowing to +Inf must not be multiplied by 0
+					if rest[m] > 0 {
+						counts[l+m] += c * rest[m]
+					}
+				}
+			}
+		} else {
+			copy(counts[1:], rest)
+		}
+		suffixes[i] = counts
+	}
+	return suffixes
+}
+
+// Generate returns a random sentence of the grammar
+func (gen *Generator) Generate() Sentence {
+	var s Sentence
+	if gen.length >= 0 {
+		gen.deriveLength(gen.gram.StartVariable(), gen.maxDepth, gen.target, &s)
+	} else {
+		gen.derive(gen.gram.StartVariable(), gen.maxDepth, &s)
+	}
+	return s
+}
+
+// derive appends to s a sentence derived from v by a tree of height at most depth
+func (gen *Generator) derive(v Variable, depth int, s *Sentence) {
+	rules := gen.rules[v]
+	weights := make([]float64, len(rules))
+	for i, r := range rules {
+		// Rules too deep to end the derivation are never chosen
+		if gen.ruleDepth[r] <= depth {
+			weights[i] = gen.weights[r]
+		}
+	}
+	r := rules[gen.choose(weights)]
+	if gen.leftParse {
+		s.LeftParse = append(s.LeftParse, r)
+	}
+	for _, sym := range gen.gram.Rules[r].Expr {
+		if ref, ok := sym.(RuleRef); ok {
+			gen.derive(ref.Variable, depth-1, s)
+		} else {
+			s.Words = append(s.Words, gen.word(sym))
+		}
+	}
+}
+
+// deriveLength appends to s a sentence of n terminals derived from v by a tree
+// of height at most depth, drawn in proportion to the weights of derivations
+func (gen *Generator) deriveLength(v Variable, depth, n int, s *Sentence) {
+	rules := gen.rules[v]
+	weights := make([]float64, len(rules))
+	suffixes := make([][][]float64, len(rules))
+	for i, r := range rules {
+		if gen.ruleDepth[r] <= depth {
+			suffixes[i] = gen.suffixCounts(gen.gram.Rules[r].Expr, depth-1, n)
+			weights[i] = gen.weights[r] * suffixes[i][0][n]
+		}
+	}
+	i := gen.choose(weights)
+	r := rules[i]
+	if gen.leftParse {
+		s.LeftParse = append(s.LeftParse, r)
+	}
+	for j, sym := range gen.gram.Rules[r].Expr {
+		ref, ok := sym.(RuleRef)
+		if !ok {
+			s.Words = append(s.Words, gen.word(sym))
+			n--
+			continue
+		}
+		// Split the terminals left between the variable and the symbols after it
+		rest := suffixes[i][j+1]
+		counts := gen.counts[depth-1][ref.Variable]
+		split := make([]float64, n+1)
+		for l := range split {
+			if counts[l] > 0 && rest[n-l] > 0 {
+				split[l] = counts[l] * rest[n-l]
+			}
+		}
+		l := gen.choose(split)
+		gen.deriveLength(ref.Variable, depth-1, l, s)
+		n -= l
+	}
+}
+
+// choose returns an index drawn in proportion to weights, one of which is
+// positive. It panics if their total is not a positive finite number, the
+// counts of derivations having overflowed.
+func (gen *Generator) choose(weights []float64) int {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	if !positiveFinite(total) {
+		panic(fmt.Sprintf("Cannot choose among weights %v", weights))
+	}
+	x := gen.rng.Float64() * total
+	last := 0
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		if x < w {
+			return i
+		}
+		x -= w
+		last = i
+	}
+	// Rounding errors can leave x past the last weight
+	return last
+}
+
+// positiveFinite reports whether w is a positive number, neither +Inf nor NaN
+func positiveFinite(w float64) bool {
+	return w > 0 && !math.IsInf(w, 1) && !math.IsNaN(w)
+}
+
+// word returns the text of a terminal, a random character for a character class
+func (gen *Generator) word(sym Symbol) string {
+	if class, ok := sym.(CharClass); ok {
+		return string(gen.char(class))
+	}
+	return sym.String()
+}
+
+// char returns a random character of class, printable unless it holds few
+// printable characters
+func (gen *Generator) char(class CharClass) rune {
+	ranges, _ := class.Ranges()
+	size := 0
+	for _, rr := range ranges {
+		size += int(rr.Hi-rr.Lo) + 1
+	}
+	draw := func() rune {
+		n := gen.rng.IntN(size)
+		for _, rr := range ranges {
+			width := int(rr.Hi-rr.Lo) + 1
+			if n < width {
+				return rr.Lo + rune(n)
+			}
+			n -= width
+		}
+		return ranges[0].Lo
+	}
+	for range 100 {
+		if r := draw(); unicode.IsPrint(r) {
+			return r
+		}
+	}
+	if r, ok := class.Example(); ok {
+		return r
+	}
+	for range 100 {
+		if r := draw(); utf8.ValidRune(r) {
+			return r
+		}
+	}
+	return ranges[0].Lo
+}
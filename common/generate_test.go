@@ -0,0 +1,299 @@
+package common
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// loadExample reads a grammar of the examples directory
+func loadExample(t *testing.T, name string) *Grammar {
+	t.Helper()
+	f, err := os.Open("../examples/" + name)
+	if err != nil {
+		t.Fatalf("Open(%s) unexpected error: %v", name, err)
+	}
+	defer f.Close()
+	g, err := ParseGrammar(f)
+	if err != nil {
+		t.Fatalf("ParseGrammar(%s) unexpected error: %v", name, err)
+	}
+	return g
+}
+
+// height returns the height of the derivation tree of a left parse, checking
+// it applies its rules to the variable they rewrite
+func height(t *testing.T, g *Grammar, leftParse []int) int {
+	t.Helper()
+	var visit func(v Variable) int
+	visit = func(v Variable) int {
+		if len(leftParse) == 0 {
+			t.Fatalf("left parse ends before %s is derived", v)
+		}
+		rule := g.Rules[leftParse[0]]
+		leftParse = leftParse[1:]
+		if rule.Variable != v {
+			t.Fatalf("left parse applies %s to %s", rule.String(), v)
+		}
+		h := 1
+		for _, sym := range rule.Expr {
+			if ref, ok := sym.(RuleRef); ok {
+				h = max(h, visit(ref.Variable)+1)
+			}
+		}
+		return h
+	}
+	h := visit(g.StartVariable())
+	if len(leftParse) > 0 {
+		t.Fatalf("left parse has %d rules left", len(leftParse))
+	}
+	return h
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		grammar string
+		depth   int
+	}{
+		{grammar: "arithmetic.bnf", depth: 8},
+		{grammar: "json.bnf", depth: 6},
+		{grammar: "palindromes.bnf", depth: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.grammar, func(t *testing.T) {
+			g := loadExample(t, tt.grammar)
+			gen, err := NewGenerator(g, WithSeed(1), WithMaxDepth(tt.depth), WithLeftParse())
+			if err != nil {
+				t.Fatalf("NewGenerator() unexpected error: %v", err)
+			}
+			for range 100 {
+				s := gen.Generate()
+				if h := height(t, g, s.LeftParse); h > tt.depth {
+					t.Errorf("Generate() derived %q by a tree of height %d", s, h)
+				}
+				if str, err := g.EvalLeftParse(s.LeftParse); err != nil || str != s.String() {
+					t.Errorf("EvalLeftParse(%v) = %q, %v, want %q", s.LeftParse, str, err, s)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateLength(t *testing.T) {
+	tests := []struct {
+		grammar  string
+		length   int
+		expected int
+	}{
+		{grammar: "arithmetic.bnf", length: 9, expected: 9},
+		{grammar: "arithmetic.bnf", length: 4, expected: 3},
+		{grammar: "json.bnf", length: 12, expected: 12},
+		{grammar: "palindromes.bnf", length: 0, expected: 0},
+		{grammar: "palindromes.bnf", length: 20, expected: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.grammar, func(t *testing.T) {
+			g := loadExample(t, tt.grammar)
+			gen, err := NewGenerator(g, WithSeed(2), WithLength(tt.length), WithLeftParse())
+			if err != nil {
+				t.Fatalf("NewGenerator() unexpected error: %v", err)
+			}
+			seen := make(map[string]bool)
+			for range 50 {
+				s := gen.Generate()
+				if len(s.Words) != tt.expected {
+					t.Errorf("Generate() = %q of %d terminals, want %d", s, len(s.Words), tt.expected)
+				}
+				if str, err := g.EvalLeftParse(s.LeftParse); err != nil || str != s.String() {
+					t.Errorf("EvalLeftParse(%v) = %q, %v, want %q", s.LeftParse, str, err, s)
+				}
+				seen[s.String()] = true
+			}
+			if tt.expected > 2 && len(seen) < 10 {
+				t.Errorf("Generate() drew %d distinct sentences out of 50", len(seen))
+			}
+		})
+	}
+}
+
+func TestGenerateSeed(t *testing.T) {
+	g := loadExample(t, "arithmetic.bnf")
+	sentences := func(opts ...GeneratorOption) []string {
+		gen, err := NewGenerator(g, opts...)
+		if err != nil {
+			t.Fatalf("NewGenerator() unexpected error: %v", err)
+		}
+		var res []string
+		for range 20 {
+			res = append(res, gen.Generate().String())
+		}
+		return res
+	}
+	if a, b := sentences(WithSeed(7)), sentences(WithSeed(7)); !slices.Equal(a, b) {
+		t.Errorf("Generate() with the same seed drew %q and %q", a, b)
+	}
+	if a, b := sentences(WithSeed(7), WithLength(7)), sentences(WithSeed(7), WithLength(7)); !slices.Equal(a, b) {
+		t.Errorf("Generate() with the same seed and length drew %q and %q", a, b)
+	}
+	if a, b := sentences(WithSeed(7)), sentences(WithSeed(8)); slices.Equal(a, b) {
+		t.Errorf("Generate() with different seeds drew %q both times", a)
+	}
+}
+
+func TestGenerateWeights(t *testing.T) {
+	source := "S -> A | B @weight=1000 ; A -> 'a' | 'a' A ; B -> 'b' | 'b' B"
+	g, err := ParseGrammar(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("ParseGrammar() unexpected error: %v", err)
+	}
+	tests := []struct {
+		name   string
+		opts   []GeneratorOption
+		prefix string
+	}{
+		{name: "annotation", opts: []GeneratorOption{WithSeed(3)}, prefix: "b"},
+		{name: "option", opts: []GeneratorOption{WithSeed(3), WithWeight(0, 1e6)}, prefix: "a"},
+		{name: "length", opts: []GeneratorOption{WithSeed(3), WithLength(5), WithWeight(0, 1e6)}, prefix: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewGenerator(g, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewGenerator() unexpected error: %v", err)
+			}
+			count := 0
+			for range 100 {
+				if strings.HasPrefix(gen.Generate().String(), tt.prefix) {
+					count++
+				}
+			}
+			if count < 95 {
+				t.Errorf("Generate() drew %d sentences starting with %q out of 100", count, tt.prefix)
+			}
+		})
+	}
+}
+
+func TestGenerateAmbiguousLength(t *testing.T) {
+	// The derivations of the empty string by E overflow float64 within the default
+	// depth, which must not let the sentences of 'b' E be drawn for a length of 1
+	tests := []struct {
+		source string
+		depth  int
+		length int
+	}{
+		{source: "S -> 'b' 'b' S | S S | ε", depth: 10, length: 1},
+		{source: "S -> 'b' 'b' S | S S | ε", depth: 10, length: 5},
+		{source: "S -> A 'c' ; A -> ε | 'b' E ; E -> E E | ε", length: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			g, err := ParseGrammar(strings.NewReader(tt.source))
+			if err != nil {
+				t.Fatalf("ParseGrammar() unexpected error: %v", err)
+			}
+			opts := []GeneratorOption{WithSeed(5), WithLength(tt.length)}
+			if tt.depth > 0 {
+				opts = append(opts, WithMaxDepth(tt.depth))
+			}
+			gen, err := NewGenerator(g, opts...)
+			if err != nil {
+				t.Fatalf("NewGenerator() unexpected error: %v", err)
+			}
+			for range 20 {
+				if s := gen.Generate(); len(s.Words) > tt.length {
+					t.Errorf("Generate() = %q of %d terminals, want at most %d", s, len(s.Words), tt.length)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateClasses(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("Ident", Expr{CharClass(`\p{L}`), Ref("Rest")}),
+		NewRule("Rest", Expr{CharClass(`[^\s]`), Ref("Rest")}),
+		NewRule("Rest", Expr{}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	gen, err := NewGenerator(g, WithSeed(4), WithLength(6))
+	if err != nil {
+		t.Fatalf("NewGenerator() unexpected error: %v", err)
+	}
+	for range 20 {
+		s := gen.Generate()
+		for i, word := range s.Words {
+			class := CharClass(`[^\s]`)
+			if i == 0 {
+				class = `\p{L}`
+			}
+			if r := []rune(word); len(r) != 1 || !class.Match(r[0]) {
+				t.Errorf("Generate() drew %q for %s", word, class)
+			}
+		}
+	}
+}
+
+func TestNewGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		opts   []GeneratorOption
+		err    string
+	}{
+		{
+			name:   "unproductive start",
+			source: "S -> 'a' S",
+			err:    "Grammar derives no strings",
+		},
+		{
+			name:   "depth too small",
+			source: "S -> A ; A -> 'a'",
+			opts:   []GeneratorOption{WithMaxDepth(1)},
+			err:    "Start variable 'S' derives no sentence within depth 1, the least depth is 2",
+		},
+		{
+			name:   "length too small",
+			source: "S -> 'a' 'b' | S S",
+			opts:   []GeneratorOption{WithLength(1)},
+			err:    "Grammar derives no sentence of at most 1 terminals within depth 13",
+		},
+		{
+			name:   "too many derivations",
+			source: "S -> 'b' 'b' S | S S | ε",
+			opts:   []GeneratorOption{WithLength(1)},
+			err:    "Grammar has too many derivations of 0 terminals, lower the target length or the maximum depth",
+		},
+		{
+			name:   "invalid weight annotation",
+			source: "S -> 'a' @weight=heavy",
+			err:    "Rule 0 has an invalid weight 'heavy', weights are positive numbers",
+		},
+		{
+			name:   "zero weight",
+			source: "S -> 'a'",
+			opts:   []GeneratorOption{WithWeight(0, 0)},
+			err:    "Weight of rule 0 must be a positive number, got 0",
+		},
+		{
+			name:   "weight of a missing rule",
+			source: "S -> 'a'",
+			opts:   []GeneratorOption{WithWeight(1, 2)},
+			err:    "Cannot weight rule '1', the grammar has 1 rules",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ParseGrammar(strings.NewReader(tt.source))
+			if err != nil {
+				t.Fatalf("ParseGrammar() unexpected error: %v", err)
+			}
+			if _, err := NewGenerator(g, tt.opts...); err == nil || err.Error() != tt.err {
+				t.Errorf("NewGenerator() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
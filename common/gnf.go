@@ -0,0 +1,79 @@
+package common
+
+import (
+	"slices"
+)
+
+// ToGNF converts a Grammar to an equivalent Grammar in Greibach Normal Form,
+// where every rule is A -> a B1...Bn, plus S -> ε for the start variable S if g
+// derives ε, in which case S occurs on no right-hand side.
+// Every step is a transformation of the previous one, parse trees of the result
+// can be folded back into parse trees of g with FoldTo.
+func (g *Grammar) ToGNF() (*Grammar, error) {
+	// Without left recursion the leftmost variables of rules form a DAG
+	h, err := g.RemoveLeftRecursion()
+	if err != nil {
+		return nil, err
+	}
+
+	// The tails introduced by left recursion removal derive ε
+	if h, err = h.removeEpsilon(true); err != nil {
+		return nil, err
+	}
+
+	// Expand leftmost variables until every rule starts with a terminal
+	if h, err = h.expandLeftmost(); err != nil {
+		return nil, err
+	}
+
+	// Terminals after the first symbol get a variable of their own
+	if h, err = h.separateTerminals(true); err != nil {
+		return nil, err
+	}
+	return h.RemoveUseless()
+}
+
+// expandLeftmost replaces rules A -> B γ by A -> δ γ for every rule B -> δ, in
+// an order where the rules of B already start with a terminal. g must be free of
+// left recursion and of ε-rules but for the start variable.
+func (g *Grammar) expandLeftmost() (*Grammar, error) {
+	rules := make(map[Variable][]derivedRule)
+	for _, rule := range g.identityRules() {
+		rules[rule.Variable] = append(rules[rule.Variable], rule)
+	}
+
+	done := make(map[Variable]bool)
+	var expand func(a Variable)
+	expand = func(a Variable) {
+		done[a] = true
+		var expanded []derivedRule
+		for _, rule := range rules[a] {
+			if len(rule.Expr) == 0 || isTerminal(rule.Expr[0]) {
+				expanded = append(expanded, rule)
+				continue
+			}
+			b := rule.Expr[0].(RuleRef).Variable
+			if !done[b] {
+				expand(b)
+			}
+			for _, sub := range rules[b] {
+				expanded = append(expanded, derivedRule{
+					Rule:   rule.derived(a, append(slices.Clone(sub.Expr), rule.Expr[1:]...)),
+					origin: substitute(rule.origin, 0, sub.origin, len(sub.Expr)),
+				})
+			}
+		}
+		rules[a] = expanded
+	}
+
+	var res []derivedRule
+	for _, v := range g.Variables.Data {
+		if !done[v] {
+			expand(v)
+		}
+	}
+	for _, v := range g.Variables.Data {
+		res = append(res, rules[v]...)
+	}
+	return g.derive("expand leftmost variables", g.StartVariable(), res)
+}
@@ -0,0 +1,107 @@
+package common_test
+
+import (
+	"testing"
+
+	. "github.com/costowell/parsing-fun/common"
+	"github.com/costowell/parsing-fun/earley"
+	"github.com/costowell/parsing-fun/internal/parsertest"
+)
+
+// sentences returns every string of at most n terminals of g, n being lowered so
+// there are at most limit strings
+func sentences(g *Grammar, limit int) []string {
+	res := []string{""}
+	level := []string{""}
+	for len(level) > 0 && len(res)+len(level)*len(g.Terminals.Data) <= limit {
+		var next []string
+		for _, s := range level {
+			for _, t := range g.Terminals.Data {
+				next = append(next, s+t.String())
+			}
+		}
+		res = append(res, next...)
+		level = next
+	}
+	return res
+}
+
+func TestToGNF(t *testing.T) {
+	cases := append([]parsertest.Case{}, parsertest.Cases...)
+	cases = append(cases,
+		parsertest.Case{
+			Name: "indirect left recursion",
+			Rules: []Rule{
+				NewRule("A", Expr{Ref("B"), Literal("a")}),
+				NewRule("A", Expr{Literal("b")}),
+				NewRule("B", Expr{Ref("A"), Literal("c")}),
+				NewRule("B", Expr{Ref("A")}),
+				NewRule("B", Expr{Literal("d")}),
+			},
+		},
+		parsertest.Case{
+			Name: "nullable left recursion",
+			Rules: []Rule{
+				NewRule("S", Expr{Ref("S"), Ref("A"), Literal("a")}),
+				NewRule("S", Expr{}),
+				NewRule("A", Expr{Literal("b")}),
+				NewRule("A", Expr{}),
+			},
+		},
+	)
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			g, err := NewGrammar(tc.Rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			gnf, err := g.ToGNF()
+			if err != nil {
+				t.Fatalf("ToGNF() unexpected error: %v", err)
+			}
+
+			start := gnf.StartVariable()
+			empty := false
+			for _, rule := range gnf.Rules {
+				empty = empty || len(rule.Expr) == 0
+			}
+			for _, rule := range gnf.Rules {
+				if len(rule.Expr) == 0 {
+					if rule.Variable != start {
+						t.Errorf("ToGNF() produced ε-rule for non-start variable: %s", rule.String())
+					}
+					continue
+				}
+				if _, ok := TerminalOf(rule.Expr[0]); !ok {
+					t.Errorf("ToGNF() produced rule not starting with a terminal: %s", rule.String())
+				}
+				for _, sym := range rule.Expr[1:] {
+					if ref, ok := sym.(RuleRef); !ok || (empty && ref.Variable == start) {
+						t.Errorf("ToGNF() produced rule with invalid symbol after the terminal: %s", rule.String())
+					}
+				}
+			}
+
+			original := earley.New(g)
+			converted := earley.New(gnf)
+			for _, input := range sentences(g, 1000) {
+				_, errOriginal := original.Parse(input)
+				tree, errConverted := converted.ParseTree(input)
+				if (errOriginal == nil) != (errConverted == nil) {
+					t.Fatalf("ToGNF() changed the language on %q: original error %v, converted error %v", input, errOriginal, errConverted)
+				}
+				if errConverted != nil {
+					continue
+				}
+				folded, err := gnf.FoldTo(tree, g)
+				if err != nil {
+					t.Fatalf("FoldTo() unexpected error on %q: %v", input, err)
+				}
+				if folded.Span != (Span{Start: 0, End: len(input)}) || folded.Variable != g.StartVariable() {
+					t.Errorf("FoldTo() unexpected tree for %q:\n%s", input, folded)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package common
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 )
 
 // Variable represents any non-terminal in a grammar
@@ -11,15 +13,31 @@ func (v Variable) String() string {
 	return string(v)
 }
 
-// Terminal represents any terminal in a grammar
+// Terminal represents any terminal in a grammar. As a Symbol it is a token kind,
+// written as an identifier declared with %token in grammar files
 type Terminal string
 
 func (t Terminal) String() string {
 	return string(t)
 }
 
-// Symbol represents a RuleRef or string
-type Symbol any
+// Literal is a terminal symbol matched literally against the input
+type Literal string
+
+func (l Literal) String() string {
+	return string(l)
+}
+
+// Symbol represents a RuleRef, a Terminal token kind, a Literal or a CharClass.
+// No other type implements it.
+type Symbol interface {
+	fmt.Stringer
+	symbol()
+}
+
+func (Terminal) symbol() {}
+func (Literal) symbol()  {}
+func (RuleRef) symbol()  {}
 
 // Expr represents an array of Symbols
 type Expr []Symbol
@@ -47,22 +65,14 @@ func (e *Expr) ApplyRuleLeft(rule *Rule) error {
 func (e *Expr) String() string {
 	var s string
 	for _, sym := range *e {
-		ref, ok := sym.(RuleRef)
-		if ok {
-			s += fmt.Sprintf("%s ", ref.Variable)
-			continue
-		}
-		str, ok := sym.(string)
-		if ok {
-			s += fmt.Sprintf("'%s' ", str)
-			continue
-		}
-		term, ok := sym.(Terminal)
-		if ok {
-			s += fmt.Sprintf("'%s' ", term)
-			continue
+		switch v := sym.(type) {
+		case RuleRef:
+			s += fmt.Sprintf("%s ", v.Variable)
+		case CharClass:
+			s += fmt.Sprintf("%s ", v)
+		default:
+			s += fmt.Sprintf("'%s' ", sym)
 		}
-		return "UNKNOWN_SYM "
 	}
 	return s
 }
@@ -71,6 +81,10 @@ func (e *Expr) String() string {
 type Rule struct {
 	Variable Variable
 	Expr     Expr
+	// Label names the rule, such as the constructor of its AST node, empty if it has none
+	Label string
+	// Annotations holds further metadata of the rule, such as its precedence
+	Annotations map[string]string
 }
 
 func (r *Rule) String() string {
@@ -80,9 +94,17 @@ func (r *Rule) String() string {
 func (r *Rule) Copy() Rule {
 	expr := make(Expr, len(r.Expr))
 	copy(expr, r.Expr)
+	return r.derived(r.Variable, expr)
+}
+
+// derived returns the rule v -> expr standing for r in a transformed grammar,
+// keeping its label and annotations
+func (r *Rule) derived(v Variable, expr Expr) Rule {
 	return Rule{
-		Variable: r.Variable,
-		Expr:     expr,
+		Variable:    v,
+		Expr:        expr,
+		Label:       r.Label,
+		Annotations: maps.Clone(r.Annotations),
 	}
 }
 
@@ -98,6 +120,10 @@ type RuleRef struct {
 	Variable Variable
 }
 
+func (r RuleRef) String() string {
+	return string(r.Variable)
+}
+
 // Ref returns a RuleRef for a given Variable
 func Ref(v Variable) RuleRef {
 	return RuleRef{
@@ -106,12 +132,25 @@ func Ref(v Variable) RuleRef {
 }
 
 type Grammar struct {
+	// Name names the grammar, empty if it has none
+	Name      string
 	Rules     []*Rule
 	RulesMap  map[Variable][]*Expr
 	Terminals OrderedSet[Terminal]
 	Variables OrderedSet[Variable]
+	// Source is the grammar this one was transformed from, nil if it was not
+	Source *Grammar
+	// Tracer receives the steps of derivations and transformations of the
+	// grammar, grammars derived from it sharing it. Parsers default to it too.
+	Tracer Tracer
+	// origins holds the provenance of each rule in terms of the rules of Source
+	origins [][]template
+	start   Variable
 }
 
+// EvalLeftParse returns the string derived by the rules of a leftmost
+// derivation. A left parse records no input, so it fails if a character class
+// is left in the derived string.
 func (g *Grammar) EvalLeftParse(leftParse []int) (string, error) {
 	expr := Expr{Ref(g.StartVariable())}
 	for _, ruleNum := range leftParse {
@@ -119,64 +158,151 @@ func (g *Grammar) EvalLeftParse(leftParse []int) (string, error) {
 			return "", fmt.Errorf("Unexpected rule number '%v', maximum is '%v'", ruleNum, len(g.Rules)-1)
 		}
 		rule := g.Rules[ruleNum]
-		fmt.Print(expr, "->")
+		before := expr
 		if err := expr.ApplyRuleLeft(rule); err != nil {
 			return "", fmt.Errorf("Failed to apply rule \"%s\" to \"%s\": %s", rule.String(), expr.String(), err.Error())
 		}
-		fmt.Printf("%s [%s]\n", expr, rule.String())
+		g.trace(DeriveEvent{Rule: ruleNum, Before: before, After: expr})
 	}
 
 	var str string
 	for _, sym := range expr {
-		switch v := sym.(type) {
-		case string:
-			str += v
-		default:
+		if class, ok := sym.(CharClass); ok {
+			return "", fmt.Errorf("Left parse of character class '%s' has no single string", class)
+		}
+		t, ok := TerminalOf(sym)
+		if !ok {
 			return "", fmt.Errorf("Incomplete left parse '%s'", expr.String())
 		}
+		str += t.String()
 	}
 	return str, nil
 }
 
+// LeftParseOf converts a right parse, the rules of a rightmost derivation in the
+// order a bottom-up parser reduces them, to the left parse of the same tree
+func (g *Grammar) LeftParseOf(rightParse []int) ([]int, error) {
+	var stack []*ParseTree
+	for _, ruleNum := range rightParse {
+		if ruleNum < 0 || ruleNum >= len(g.Rules) {
+			return nil, fmt.Errorf("Unexpected rule number '%v', maximum is '%v'", ruleNum, len(g.Rules)-1)
+		}
+		rule := g.Rules[ruleNum]
+		var vars []Variable
+		for _, sym := range rule.Expr {
+			if ref, ok := sym.(RuleRef); ok {
+				vars = append(vars, ref.Variable)
+			}
+		}
+		if len(vars) > len(stack) {
+			return nil, fmt.Errorf("Rule \"%s\" reduces more variables than were derived", rule.String())
+		}
+		children := stack[len(stack)-len(vars):]
+		for i, v := range vars {
+			if children[i].Variable != v {
+				return nil, fmt.Errorf("Rule \"%s\" expects '%s' where '%s' was derived", rule.String(), v, children[i].Variable)
+			}
+		}
+		node := &ParseTree{Rule: ruleNum, Variable: rule.Variable, Children: slices.Clone(children)}
+		stack = append(stack[:len(stack)-len(vars)], node)
+	}
+	if len(stack) != 1 || stack[0].Variable != g.StartVariable() {
+		return nil, fmt.Errorf("Incomplete right parse '%v'", rightParse)
+	}
+	return stack[0].LeftParse(), nil
+}
+
+// StartVariable returns the variable the language of the grammar is derived
+// from, the variable of the first rule unless given by WithStart
 func (g *Grammar) StartVariable() Variable {
-	return g.Rules[0].Variable
+	return g.start
 }
 
-func (g *Grammar) String() string {
-	var s string
-	s += fmt.Sprintf("Terminals: %v\n", g.Terminals)
-	s += fmt.Sprintf("Variables: %v\n", g.Variables)
-	for v, exprs := range g.RulesMap {
-		s += fmt.Sprintf("%s -> %s", v, exprs[0])
-		for _, expr := range exprs[1:] {
-			s += fmt.Sprintf(" | %s", expr)
+// GrammarOption configures a grammar created by NewGrammar
+type GrammarOption func(g *Grammar) error
+
+// WithStart sets the start variable of the grammar, which must have rules
+func WithStart(v Variable) GrammarOption {
+	return func(g *Grammar) error {
+		g.start = v
+		return nil
+	}
+}
+
+// WithName names the grammar
+func WithName(name string) GrammarOption {
+	return func(g *Grammar) error {
+		g.Name = name
+		return nil
+	}
+}
+
+// WithLabel labels the rule numbered rule
+func WithLabel(rule int, label string) GrammarOption {
+	return func(g *Grammar) error {
+		if rule < 0 || rule >= len(g.Rules) {
+			return fmt.Errorf("Cannot label rule '%d', the grammar has %d rules", rule, len(g.Rules))
+		}
+		g.Rules[rule].Label = label
+		return nil
+	}
+}
+
+// WithAnnotation annotates the rule numbered rule with a key and a value
+func WithAnnotation(rule int, key, value string) GrammarOption {
+	return func(g *Grammar) error {
+		if rule < 0 || rule >= len(g.Rules) {
+			return fmt.Errorf("Cannot annotate rule '%d', the grammar has %d rules", rule, len(g.Rules))
 		}
-		s += "\n"
+		r := g.Rules[rule]
+		if r.Annotations == nil {
+			r.Annotations = make(map[string]string)
+		}
+		r.Annotations[key] = value
+		return nil
 	}
-	return s
 }
 
-func NewGrammar(rules []Rule) (*Grammar, error) {
+func NewGrammar(rules []Rule, opts ...GrammarOption) (*Grammar, error) {
 	ruleMap := make(map[Variable][]*Expr, len(rules))
 	variableMap := make(map[Variable]bool)
 	terminals := NewOrderedSet[Terminal]()
+	// Whether each terminal stands for a class, which must not also be matched literally
+	classes := make(map[Terminal]bool)
 	variables := NewOrderedSet[Variable]()
 	var rulesP []*Rule
 
 	// Init map
-	for _, rule := range rules {
+	for i, rule := range rules {
 		if _, ok := ruleMap[rule.Variable]; !ok {
 			ruleMap[rule.Variable] = make([]*Expr, 0)
 		}
+		rule.Annotations = maps.Clone(rule.Annotations)
 		ruleMap[rule.Variable] = append(ruleMap[rule.Variable], &rule.Expr)
 		variableMap[rule.Variable] = true
 		rulesP = append(rulesP, &rule)
 
 		variables.Insert(rule.Variable)
-		for _, sym := range rule.Expr {
+		for j, sym := range rule.Expr {
 			switch v := sym.(type) {
-			case string:
-				terminals.Insert(Terminal(v))
+			case nil:
+				return nil, fmt.Errorf("Rule %d has no symbol at position %d", i, j)
+			case Literal, Terminal, CharClass:
+				t, _ := TerminalOf(v)
+				if t == EndOfInput {
+					return nil, fmt.Errorf("Rule %d has an empty terminal at position %d, an empty Expr derives ε", i, j)
+				}
+				if c, ok := v.(CharClass); ok {
+					if _, err := c.Ranges(); err != nil {
+						return nil, fmt.Errorf("Rule %d at position %d: %s", i, j, err.Error())
+					}
+				}
+				_, class := v.(CharClass)
+				if seen, ok := classes[t]; ok && seen != class {
+					return nil, fmt.Errorf("Terminal '%s' of rule %d is used both as a character class and literally", t, i)
+				}
+				classes[t] = class
+				terminals.Insert(t)
 			case RuleRef:
 				if _, ok := variableMap[v.Variable]; !ok {
 					variableMap[v.Variable] = false
@@ -196,5 +322,16 @@ func NewGrammar(rules []Rule) (*Grammar, error) {
 		Variables: variables,
 		Terminals: terminals,
 	}
+	if len(rules) > 0 {
+		g.start = rules[0].Variable
+	}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
+		}
+	}
+	if len(rules) > 0 && !variables.Contains(g.start) {
+		return nil, fmt.Errorf("Start variable '%s' is not defined", g.start)
+	}
 	return g, nil
 }
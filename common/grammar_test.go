@@ -1,6 +1,7 @@
 package common
 
 import (
+	"slices"
 	"testing"
 )
 
@@ -13,7 +14,7 @@ func TestNewGrammar(t *testing.T) {
 		{
 			name: "simple grammar",
 			rules: []Rule{
-				NewRule("A", Expr{"a"}),
+				NewRule("A", Expr{Literal("a")}),
 			},
 			expectError: false,
 		},
@@ -24,6 +25,65 @@ func TestNewGrammar(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "token kinds and literals",
+			rules: []Rule{
+				NewRule("A", Expr{Terminal("NUMBER"), Literal("+"), Ref("B")}),
+				NewRule("B", Expr{Terminal("NUMBER")}),
+			},
+			expectError: false,
+		},
+		{
+			name: "nil symbol",
+			rules: []Rule{
+				NewRule("A", Expr{Literal("a"), nil}),
+			},
+			expectError: true,
+		},
+		{
+			name: "empty literal",
+			rules: []Rule{
+				NewRule("A", Expr{Literal("")}),
+			},
+			expectError: true,
+		},
+		{
+			name: "empty token kind",
+			rules: []Rule{
+				NewRule("A", Expr{Terminal("")}),
+			},
+			expectError: true,
+		},
+		{
+			name: "character classes",
+			rules: []Rule{
+				NewRule("A", Expr{CharClass("[a-z]"), Ref("B")}),
+				NewRule("B", Expr{CharClass(`\p{L}`), Literal("0")}),
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid character class",
+			rules: []Rule{
+				NewRule("A", Expr{CharClass("[z-a]")}),
+			},
+			expectError: true,
+		},
+		{
+			name: "class of a string",
+			rules: []Rule{
+				NewRule("A", Expr{CharClass("ab")}),
+			},
+			expectError: true,
+		},
+		{
+			name: "class also matched literally",
+			rules: []Rule{
+				NewRule("A", Expr{CharClass("[0-9]"), Ref("B")}),
+				NewRule("B", Expr{Literal("[0-9]")}),
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -45,11 +105,60 @@ func TestNewGrammar(t *testing.T) {
 	}
 }
 
+func TestNewGrammarOptions(t *testing.T) {
+	rules := []Rule{
+		NewRule("S", Expr{Ref("T"), Literal("+"), Ref("S")}),
+		NewRule("S", Expr{Ref("T")}),
+		NewRule("T", Expr{Literal("1")}),
+	}
+	tests := []struct {
+		name  string
+		opts  []GrammarOption
+		start Variable
+		err   string
+	}{
+		{name: "first rule", start: "S"},
+		{name: "explicit start", opts: []GrammarOption{WithStart("T")}, start: "T"},
+		{name: "undefined start", opts: []GrammarOption{WithStart("U")}, err: "Start variable 'U' is not defined"},
+		{name: "label out of range", opts: []GrammarOption{WithLabel(3, "X")}, err: "Cannot label rule '3', the grammar has 3 rules"},
+		{name: "annotation out of range", opts: []GrammarOption{WithAnnotation(-1, "prec", "1")}, err: "Cannot annotate rule '-1', the grammar has 3 rules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(rules, tt.opts...)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("NewGrammar() error = %v, wanted %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			if g.StartVariable() != tt.start {
+				t.Errorf("StartVariable() = %s, wanted %s", g.StartVariable(), tt.start)
+			}
+		})
+	}
+
+	g, err := NewGrammar(rules, WithName("sums"), WithLabel(0, "Add"), WithAnnotation(0, "assoc", "right"))
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	if g.Name != "sums" || g.Rules[0].Label != "Add" || g.Rules[0].Annotations["assoc"] != "right" {
+		t.Errorf("NewGrammar() name %q and first rule %#v", g.Name, *g.Rules[0])
+	}
+	if rules[0].Label != "" || rules[0].Annotations != nil {
+		t.Errorf("NewGrammar() modified the rules it was given: %#v", rules[0])
+	}
+}
+
 func TestGrammarEvalLeftParse(t *testing.T) {
 	rules := []Rule{
-		NewRule("S", Expr{"a", Ref("B"), Ref("C")}),
-		NewRule("B", Expr{"b"}),
-		NewRule("C", Expr{"c"}),
+		NewRule("S", Expr{Literal("a"), Ref("B"), Ref("C")}),
+		NewRule("B", Expr{Literal("b")}),
+		NewRule("C", Expr{Literal("c")}),
+		NewRule("S", Expr{CharClass("[0-9]")}),
 	}
 
 	gram, err := NewGrammar(rules)
@@ -71,7 +180,7 @@ func TestGrammarEvalLeftParse(t *testing.T) {
 		},
 		{
 			name:        "unknown rule",
-			leftParse:   []int{3},
+			leftParse:   []int{4},
 			expected:    "",
 			expectError: true,
 		},
@@ -87,6 +196,12 @@ func TestGrammarEvalLeftParse(t *testing.T) {
 			expected:    "",
 			expectError: true,
 		},
+		{
+			name:        "character class",
+			leftParse:   []int{3},
+			expected:    "",
+			expectError: true,
+		},
 		{
 			name:        "empty parse",
 			leftParse:   []int{},
@@ -122,40 +237,40 @@ func TestApplyRuleLeft(t *testing.T) {
 	}{
 		{
 			name: "successful rule application",
-			expr: Expr{"a", Ref("B"), "c"},
+			expr: Expr{Literal("a"), Ref("B"), Literal("c")},
 			rule: &Rule{
 				Variable: "B",
-				Expr:     Expr{"b1", "b2"},
+				Expr:     Expr{Literal("b1"), Literal("b2")},
 			},
-			expected:    Expr{"a", "b1", "b2", "c"},
+			expected:    Expr{Literal("a"), Literal("b1"), Literal("b2"), Literal("c")},
 			expectError: false,
 		},
 		{
 			name: "rule not found",
-			expr: Expr{"a", Ref("C"), "c"},
+			expr: Expr{Literal("a"), Ref("C"), Literal("c")},
 			rule: &Rule{
 				Variable: "B",
-				Expr:     Expr{"b1", "b2"},
+				Expr:     Expr{Literal("b1"), Literal("b2")},
 			},
 			expected:    Expr{},
 			expectError: true,
 		},
 		{
 			name: "leftmost rule not match",
-			expr: Expr{"a", Ref("C"), Ref("B"), "c"},
+			expr: Expr{Literal("a"), Ref("C"), Ref("B"), Literal("c")},
 			rule: &Rule{
 				Variable: "B",
-				Expr:     Expr{"b1", "b2"},
+				Expr:     Expr{Literal("b1"), Literal("b2")},
 			},
 			expected:    Expr{},
 			expectError: true,
 		},
 		{
 			name: "no rule refs in expr",
-			expr: Expr{"a", "b", "c"},
+			expr: Expr{Literal("a"), Literal("b"), Literal("c")},
 			rule: &Rule{
 				Variable: "B",
-				Expr:     Expr{"b1", "b2"},
+				Expr:     Expr{Literal("b1"), Literal("b2")},
 			},
 			expected:    Expr{},
 			expectError: true,
@@ -191,3 +306,65 @@ func TestApplyRuleLeft(t *testing.T) {
 		})
 	}
 }
+
+func TestGrammarLeftParseOf(t *testing.T) {
+	rules := []Rule{
+		NewRule("S", Expr{Literal("a"), Ref("B"), Ref("C")}),
+		NewRule("B", Expr{Literal("b")}),
+		NewRule("C", Expr{Literal("c")}),
+	}
+
+	gram, err := NewGrammar(rules)
+	if err != nil {
+		t.Fatalf("NewGrammar() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		rightParse  []int
+		expected    []int
+		expectError bool
+	}{
+		{
+			name:       "valid right parse",
+			rightParse: []int{1, 2, 0},
+			expected:   []int{0, 1, 2},
+		},
+		{
+			name:        "unknown rule",
+			rightParse:  []int{3},
+			expectError: true,
+		},
+		{
+			name:        "variables out of order",
+			rightParse:  []int{2, 1, 0},
+			expectError: true,
+		},
+		{
+			name:        "incomplete parse",
+			rightParse:  []int{1, 2},
+			expectError: true,
+		},
+		{
+			name:        "empty parse",
+			rightParse:  []int{},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := gram.LeftParseOf(tt.rightParse)
+
+			if tt.expectError && err == nil {
+				t.Errorf("LeftParseOf() expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("LeftParseOf() unexpected error: %v", err)
+			}
+			if !tt.expectError && !slices.Equal(result, tt.expected) {
+				t.Errorf("LeftParseOf() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
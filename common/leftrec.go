@@ -0,0 +1,165 @@
+package common
+
+import (
+	"slices"
+)
+
+// leftCorners returns for every variable the variables occurring after a
+// nullable prefix of one of its rules
+func (g *Grammar) leftCorners(nullable map[Variable]bool) map[Variable][]derivation {
+	edges := make(map[Variable][]derivation)
+	for r, rule := range g.Rules {
+		for _, sym := range rule.Expr {
+			ref, ok := sym.(RuleRef)
+			if !ok {
+				break
+			}
+			edges[rule.Variable] = append(edges[rule.Variable], derivation{rule: r, to: ref.Variable})
+			if !nullable[ref.Variable] {
+				break
+			}
+		}
+	}
+	return edges
+}
+
+// leftRecursive returns the variables deriving a sentential form starting with
+// themselves, in the order of g.Variables
+func (g *Grammar) leftRecursive() []Variable {
+	var res []Variable
+	for _, w := range witnesses(g.Variables.Data, g.leftCorners(g.FirstFollow().Nullable)) {
+		res = append(res, w.Variable)
+	}
+	return res
+}
+
+// epsilonRules returns the ε-rules of g, but for one of a start variable that
+// occurs on no right-hand side
+func (g *Grammar) epsilonRules() []int {
+	startUsed := false
+	for _, rule := range g.Rules {
+		for _, sym := range rule.Expr {
+			if ref, ok := sym.(RuleRef); ok && ref.Variable == g.StartVariable() {
+				startUsed = true
+			}
+		}
+	}
+	var res []int
+	for i, rule := range g.Rules {
+		if len(rule.Expr) == 0 && (startUsed || rule.Variable != g.StartVariable()) {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// RemoveLeftRecursion removes direct and indirect left recursion, so no
+// variable derives a sentential form starting with itself. The language is
+// preserved.
+// ε-rules and cycles are removed first when g has any, keeping ε through a
+// fresh start variable. Each left-recursive variable A -> A α | β then becomes
+// A -> β A', A' -> α A' | ε with A' a fresh variable.
+func (g *Grammar) RemoveLeftRecursion() (*Grammar, error) {
+	h := g
+	var err error
+	if len(h.epsilonRules()) > 0 {
+		if h, err = h.addStart(); err != nil {
+			return nil, err
+		}
+		if h, err = h.removeEpsilon(true); err != nil {
+			return nil, err
+		}
+	}
+	if h.isCyclic() {
+		if h, err = h.RemoveCycles(); err != nil {
+			return nil, err
+		}
+	}
+	return h.removeLeftRecursion()
+}
+
+// removeLeftRecursion is Paull's algorithm on an ε-free and cycle-free grammar
+func (g *Grammar) removeLeftRecursion() (*Grammar, error) {
+	used := g.usedVariables()
+	order := slices.Clone(g.Variables.Data)
+	rules := make(map[Variable][]derivedRule)
+	for _, rule := range g.identityRules() {
+		rules[rule.Variable] = append(rules[rule.Variable], rule)
+	}
+	tails := make(map[Variable][]derivedRule)
+
+	for i, a := range order {
+		// Expand the rules of a starting with an earlier variable, which by now
+		// only start with later variables or terminals
+		for _, b := range order[:i] {
+			var expanded []derivedRule
+			for _, rule := range rules[a] {
+				if len(rule.Expr) == 0 || rule.Expr[0] != Ref(b) {
+					expanded = append(expanded, rule)
+					continue
+				}
+				for _, sub := range rules[b] {
+					expanded = append(expanded, derivedRule{
+						Rule:   rule.derived(a, append(slices.Clone(sub.Expr), rule.Expr[1:]...)),
+						origin: substitute(rule.origin, 0, sub.origin, len(sub.Expr)),
+					})
+				}
+			}
+			rules[a] = expanded
+		}
+		rules[a], tails[a] = removeDirectLeftRecursion(a, rules[a], &used)
+	}
+
+	var res []derivedRule
+	for _, v := range order {
+		res = append(res, rules[v]...)
+		res = append(res, tails[v]...)
+	}
+	return g.derive("remove left recursion", g.StartVariable(), res)
+}
+
+// removeDirectLeftRecursion rewrites the rules A -> A α | β of a as A -> β A'
+// and the rules of a fresh variable A' -> α A' | ε.
+// A' stands for the left-deep chain of A -> A α applications above β: it is
+// folded with the tree of A built so far as its accumulated subtree.
+func removeDirectLeftRecursion(a Variable, rules []derivedRule, used *OrderedSet[Variable]) ([]derivedRule, []derivedRule) {
+	var recursive, other []derivedRule
+	for _, rule := range rules {
+		if len(rule.Expr) > 0 && rule.Expr[0] == Ref(a) {
+			recursive = append(recursive, rule)
+		} else {
+			other = append(other, rule)
+		}
+	}
+	if len(recursive) == 0 {
+		return rules, nil
+	}
+	// Without a base case a derives nothing, its rules are dropped
+	if len(other) == 0 {
+		return nil, nil
+	}
+
+	tail := freshVariable(used, a.String()+"'")
+	var heads []derivedRule
+	for _, rule := range other {
+		heads = append(heads, derivedRule{
+			Rule:   rule.derived(a, append(slices.Clone(rule.Expr), Ref(tail))),
+			origin: []template{tPass{hole: len(rule.Expr), acc: rule.origin[0]}},
+		})
+	}
+	var tails []derivedRule
+	for _, rule := range recursive {
+		alpha := rule.Expr[1:]
+		// The A child of A -> A α is the accumulated subtree
+		acc := substitute(rule.origin, 0, []template{tAcc{}}, 0)[0]
+		tails = append(tails, derivedRule{
+			Rule:   rule.derived(tail, append(slices.Clone(alpha), Ref(tail))),
+			origin: []template{tPass{hole: len(alpha), acc: acc}},
+		})
+	}
+	tails = append(tails, derivedRule{
+		Rule:   NewRule(tail, Expr{}),
+		origin: []template{tAcc{}},
+	})
+	return heads, tails
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestRemoveLeftRecursion(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		// fresh holds variables expected to be introduced
+		fresh []Variable
+	}{
+		{
+			name: "direct",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("S"), Literal("+"), Ref("M")}),
+				NewRule("S", Expr{Ref("M")}),
+				NewRule("M", Expr{Ref("M"), Literal("*"), Ref("T")}),
+				NewRule("M", Expr{Ref("T")}),
+				NewRule("T", Expr{Literal("1")}),
+				NewRule("T", Expr{Literal("2")}),
+			},
+			fresh: []Variable{"S'", "M'"},
+		},
+		{
+			name: "indirect",
+			rules: []Rule{
+				NewRule("A", Expr{Ref("B"), Literal("a")}),
+				NewRule("A", Expr{Literal("b")}),
+				NewRule("B", Expr{Ref("A"), Literal("c")}),
+				NewRule("B", Expr{Literal("d")}),
+			},
+			fresh: []Variable{"B'"},
+		},
+		{
+			name: "hidden by nullable prefix",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A"), Ref("S"), Literal("a")}),
+				NewRule("S", Expr{Literal("b")}),
+				NewRule("A", Expr{Literal("c")}),
+				NewRule("A", Expr{}),
+			},
+		},
+		{
+			name: "nullable start",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("S"), Literal("a")}),
+				NewRule("S", Expr{}),
+			},
+		},
+		{
+			name: "cycle",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A")}),
+				NewRule("S", Expr{Ref("S"), Literal("x")}),
+				NewRule("S", Expr{Literal("y")}),
+				NewRule("A", Expr{Ref("S")}),
+			},
+		},
+		{
+			name: "name collision",
+			rules: []Rule{
+				NewRule("E", Expr{Ref("E"), Literal("+"), Ref("E'")}),
+				NewRule("E", Expr{Ref("E'")}),
+				NewRule("E'", Expr{Literal("x")}),
+			},
+			fresh: []Variable{"E'_1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			h, err := g.RemoveLeftRecursion()
+			if err != nil {
+				t.Fatalf("RemoveLeftRecursion() unexpected error: %v", err)
+			}
+			if vars := h.leftRecursive(); len(vars) > 0 {
+				t.Errorf("RemoveLeftRecursion() left %v left recursive in\n%s", vars, h)
+			}
+			for _, v := range tt.fresh {
+				if !h.Variables.Contains(v) {
+					t.Errorf("RemoveLeftRecursion() did not introduce %s in\n%s", v, h)
+				}
+			}
+
+			expected := language(g, 6)
+			if got := language(h, 6); !maps.Equal(got, expected) {
+				t.Errorf("RemoveLeftRecursion() derives %v, want %v", slices.Sorted(maps.Keys(got)), slices.Sorted(maps.Keys(expected)))
+			}
+
+			for _, tree := range derivations(h, h.StartVariable(), 5) {
+				folded, err := h.FoldTo(tree, g)
+				if err != nil {
+					t.Fatalf("FoldTo() unexpected error: %v\n%s", err, tree)
+				}
+				if err := validTree(g, folded); err != nil {
+					t.Fatalf("FoldTo() invalid tree: %v\n%s", err, folded)
+				}
+				if yield(folded) != yield(tree) {
+					t.Fatalf("FoldTo() yields %q, want %q", yield(folded), yield(tree))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Span is the half-open range [Start, End) of byte offsets a token or node covers in the input
+type Span struct {
+	Start int
+	End   int
+}
+
+// Token is a lexeme of the input classified by a token kind
+type Token struct {
+	Kind   Terminal
+	Lexeme string
+	Span   Span
+}
+
+// Lexer splits an input string into a stream of tokens
+type Lexer interface {
+	Tokenize(input string) ([]Token, error)
+}
+
+// TokenDef defines a token kind by a regular expression.
+// When several definitions match, the longest match wins, ties are broken by the
+// highest Priority and then by definition order. Skipped tokens (whitespace,
+// comments...) are matched but never emitted.
+type TokenDef struct {
+	Kind     Terminal
+	Pattern  string
+	Priority int
+	Skip     bool
+}
+
+type regexLexer struct {
+	defs     []TokenDef
+	patterns []*regexp.Regexp
+}
+
+// NewRegexLexer creates a Lexer from a list of token definitions
+func NewRegexLexer(defs []TokenDef) (Lexer, error) {
+	patterns := make([]*regexp.Regexp, len(defs))
+	for i, def := range defs {
+		re, err := regexp.Compile(`^(?:` + def.Pattern + `)`)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern for token '%s': %s", def.Kind, err.Error())
+		}
+		re.Longest()
+		patterns[i] = re
+	}
+	return &regexLexer{
+		defs:     defs,
+		patterns: patterns,
+	}, nil
+}
+
+func (l *regexLexer) Tokenize(input string) ([]Token, error) {
+	tokens := make([]Token, 0)
+	for pos := 0; pos < len(input); {
+		best, bestLen := -1, 0
+		for i, re := range l.patterns {
+			loc := re.FindStringIndex(input[pos:])
+			// Empty matches would never make progress
+			if loc == nil || loc[1] == 0 {
+				continue
+			}
+			if loc[1] > bestLen || (loc[1] == bestLen && l.defs[i].Priority > l.defs[best].Priority) {
+				best, bestLen = i, loc[1]
+			}
+		}
+		if best < 0 {
+			r, _ := utf8.DecodeRuneInString(input[pos:])
+			line, col := LineColumn(input, pos)
+			return nil, fmt.Errorf("Unexpected character %q at %d:%d", r, line, col)
+		}
+
+		if !l.defs[best].Skip {
+			tokens = append(tokens, Token{
+				Kind:   l.defs[best].Kind,
+				Lexeme: input[pos : pos+bestLen],
+				Span:   Span{Start: pos, End: pos + bestLen},
+			})
+		}
+		pos += bestLen
+	}
+	return tokens, nil
+}
+
+// NewLiteralLexer creates a Lexer matching the terminals of g literally, the kind
+// of each token is the terminal it matched. Overlapping terminals are resolved by
+// longest match.
+func NewLiteralLexer(g *Grammar) Lexer {
+	defs := make([]TokenDef, 0, len(g.Terminals.Data))
+	for _, t := range g.Terminals.Data {
+		if t != EndOfInput {
+			defs = append(defs, TokenDef{Kind: t, Pattern: regexp.QuoteMeta(t.String())})
+		}
+	}
+	// Quoted patterns always compile
+	lexer, _ := NewRegexLexer(defs)
+	return lexer
+}
+
+// LineColumn returns the 1-based line and column (in runes) of a byte offset into input
+func LineColumn(input string, offset int) (int, int) {
+	line, col := 1, 1
+	for i, r := range input {
+		if i >= offset {
+			break
+		}
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
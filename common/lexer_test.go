@@ -0,0 +1,105 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestRegexLexer(t *testing.T) {
+	lexer, err := NewRegexLexer([]TokenDef{
+		{Kind: "WS", Pattern: `\s+`, Skip: true},
+		{Kind: "COMMENT", Pattern: `//[^\n]*`, Skip: true},
+		{Kind: "IDENT", Pattern: `[a-z]+`},
+		{Kind: "while", Pattern: `while`, Priority: 1},
+		{Kind: "NUM", Pattern: `[0-9]+`},
+		{Kind: "<", Pattern: `<`},
+		{Kind: "<=", Pattern: `<=`},
+	})
+	if err != nil {
+		t.Fatalf("NewRegexLexer() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    []Token
+		expectError bool
+	}{
+		{
+			name:  "keyword priority",
+			input: "while whiles",
+			expected: []Token{
+				{Kind: "while", Lexeme: "while", Span: Span{0, 5}},
+				{Kind: "IDENT", Lexeme: "whiles", Span: Span{6, 12}},
+			},
+		},
+		{
+			name:  "longest match",
+			input: "a<=10 // done",
+			expected: []Token{
+				{Kind: "IDENT", Lexeme: "a", Span: Span{0, 1}},
+				{Kind: "<=", Lexeme: "<=", Span: Span{1, 3}},
+				{Kind: "NUM", Lexeme: "10", Span: Span{3, 5}},
+			},
+		},
+		{
+			name:     "empty",
+			input:    "",
+			expected: []Token{},
+		},
+		{
+			name:        "unknown character",
+			input:       "a\n+",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lexer.Tokenize(tt.input)
+			if tt.expectError && err == nil {
+				t.Errorf("Tokenize() expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Tokenize() unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if len(tokens) != len(tt.expected) {
+				t.Fatalf("Tokenize() = %v, want %v", tokens, tt.expected)
+			}
+			for i := range tokens {
+				if tokens[i] != tt.expected[i] {
+					t.Errorf("Tokenize()[%d] = %v, want %v", i, tokens[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewRegexLexerInvalidPattern(t *testing.T) {
+	if _, err := NewRegexLexer([]TokenDef{{Kind: "BAD", Pattern: `(`}}); err == nil {
+		t.Errorf("NewRegexLexer() expected error but got none")
+	}
+}
+
+func TestLineColumn(t *testing.T) {
+	input := "ab\nçd\n"
+	tests := []struct {
+		offset int
+		line   int
+		col    int
+	}{
+		{0, 1, 1},
+		{2, 1, 3},
+		{3, 2, 1},
+		{6, 2, 3},
+		{7, 3, 1},
+	}
+	for _, tt := range tests {
+		line, col := LineColumn(input, tt.offset)
+		if line != tt.line || col != tt.col {
+			t.Errorf("LineColumn(%d) = %d:%d, want %d:%d", tt.offset, line, col, tt.line, tt.col)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// identifierPattern matches the names of variables and token kinds in the
+// grammar file format, nonIdentifier the characters they cannot hold and
+// barePattern the values written without quotes, classPattern the character
+// classes written as such
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_']*$`)
+	nonIdentifier     = regexp.MustCompile(`[^A-Za-z0-9_']`)
+	barePattern       = regexp.MustCompile(`^(?:[A-Za-z_][A-Za-z0-9_']*|[0-9]+)$`)
+	classPattern      = regexp.MustCompile(`^(?:` + classSyntax + `)$`)
+)
+
+// Kinds returns the terminals used by rules as token kinds rather than literal
+// strings, in the order of g.Terminals
+func (g *Grammar) Kinds() []Terminal {
+	used := make(map[Terminal]bool)
+	for _, rule := range g.Rules {
+		for _, sym := range rule.Expr {
+			if t, ok := sym.(Terminal); ok {
+				used[t] = true
+			}
+		}
+	}
+	var kinds []Terminal
+	for _, t := range g.Terminals.Data {
+		if t != EndOfInput && used[t] {
+			kinds = append(kinds, t)
+		}
+	}
+	return kinds
+}
+
+// String returns g in the grammar file format, see MarshalText
+func (g *Grammar) String() string {
+	var sb strings.Builder
+	g.writeText(&sb)
+	return sb.String()
+}
+
+// MarshalText returns g in the canonical form of the grammar file format read by
+// ParseGrammar: its name, its start variable unless it is the variable of the
+// first rule, the token kinds, then the rules in the order of g.Rules with
+// consecutive rules of a variable written as alternatives. Parsing it back
+// gives the same rules with the same numbers, labels and annotations.
+func (g *Grammar) MarshalText() ([]byte, error) {
+	names := make(map[string]bool)
+	for _, v := range g.Variables.Data {
+		if !identifierPattern.MatchString(v.String()) {
+			return nil, fmt.Errorf("Variable '%s' is not an identifier", v)
+		}
+		names[v.String()] = true
+	}
+	for _, t := range g.Kinds() {
+		if !identifierPattern.MatchString(t.String()) {
+			return nil, fmt.Errorf("Token kind '%s' is not an identifier", t)
+		}
+		if names[t.String()] {
+			return nil, fmt.Errorf("Token kind '%s' is also a variable", t)
+		}
+	}
+	for _, c := range g.Classes() {
+		if !classPattern.MatchString(c.String()) {
+			return nil, fmt.Errorf("Character class '%s' cannot be written in a grammar file", c)
+		}
+	}
+	for i, rule := range g.Rules {
+		for key := range rule.Annotations {
+			if !identifierPattern.MatchString(key) {
+				return nil, fmt.Errorf("Annotation key '%s' of rule %d is not an identifier", key, i)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	g.writeText(&buf)
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText replaces g by the grammar read by ParseGrammar from data
+func (g *Grammar) UnmarshalText(data []byte) error {
+	h, err := ParseGrammar(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	*g = *h
+	return nil
+}
+
+// writeText writes g in the grammar file format, whether or not it can be parsed back
+func (g *Grammar) writeText(w io.StringWriter) {
+	if g.Name != "" {
+		w.WriteString("%name " + textValue(g.Name) + " ;\n")
+	}
+	if len(g.Rules) > 0 && g.StartVariable() != g.Rules[0].Variable {
+		w.WriteString("%start " + g.StartVariable().String() + " ;\n")
+	}
+	if kinds := g.Kinds(); len(kinds) > 0 {
+		names := make([]string, len(kinds))
+		for i, t := range kinds {
+			names[i] = t.String()
+		}
+		w.WriteString("%token " + strings.Join(names, " ") + " ;\n")
+	}
+	for i := 0; i < len(g.Rules); {
+		v := g.Rules[i].Variable
+		var alts []string
+		for ; i < len(g.Rules) && g.Rules[i].Variable == v; i++ {
+			alts = append(alts, textExpr(g.Rules[i].Expr)+textMeta(g.Rules[i]))
+		}
+		w.WriteString(fmt.Sprintf("%s -> %s ;\n", v, strings.Join(alts, " | ")))
+	}
+}
+
+// textExpr returns expr as an alternative of the grammar file format
+func textExpr(expr Expr) string {
+	if len(expr) == 0 {
+		return "ε"
+	}
+	syms := make([]string, len(expr))
+	for i, sym := range expr {
+		if _, ok := sym.(Literal); ok {
+			syms[i] = quote(sym.String())
+		} else {
+			syms[i] = sym.String()
+		}
+	}
+	return strings.Join(syms, " ")
+}
+
+// textMeta returns the label and annotations of rule as written after its
+// alternative, annotations ordered by key
+func textMeta(rule *Rule) string {
+	var s string
+	if rule.Label != "" {
+		s += " @" + textValue(rule.Label)
+	}
+	for _, key := range slices.Sorted(maps.Keys(rule.Annotations)) {
+		s += " @" + key + "=" + textValue(rule.Annotations[key])
+	}
+	return s
+}
+
+// textValue returns s bare if it is an identifier or a number, quoted otherwise
+func textValue(s string) string {
+	if barePattern.MatchString(s) {
+		return s
+	}
+	return quote(s)
+}
+
+// quote returns s as a quoted terminal, escaping what the grammar file format requires
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return "'" + r.Replace(s) + "'"
+}
+
+// grammarJSON is the JSON form of a grammar
+type grammarJSON struct {
+	Name      string     `json:"name,omitempty"`
+	Start     Variable   `json:"start"`
+	Terminals []Terminal `json:"terminals"`
+	Kinds     []Terminal `json:"kinds,omitempty"`
+	Variables []Variable `json:"variables"`
+	Rules     []ruleJSON `json:"rules"`
+}
+
+type ruleJSON struct {
+	Variable    Variable          `json:"variable"`
+	Expr        []symbolJSON      `json:"expr"`
+	Label       string            `json:"label,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// symbolJSON is a symbol of a rule, Type being "variable", "literal", "kind" or "class"
+type symbolJSON struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// MarshalJSON returns g as a JSON object holding its name, start variable,
+// terminals, token kinds, variables and rules in the order of g.Rules with their
+// labels and annotations, each symbol of a rule being an object of a type and a
+// value. The provenance of transformed grammars is not included.
+func (g *Grammar) MarshalJSON() ([]byte, error) {
+	res := grammarJSON{
+		Name:      g.Name,
+		Start:     g.StartVariable(),
+		Terminals: slices.DeleteFunc(append([]Terminal{}, g.Terminals.Data...), func(t Terminal) bool { return t == EndOfInput }),
+		Kinds:     g.Kinds(),
+		Variables: g.Variables.Data,
+		Rules:     make([]ruleJSON, len(g.Rules)),
+	}
+	for i, rule := range g.Rules {
+		expr := make([]symbolJSON, len(rule.Expr))
+		for j, sym := range rule.Expr {
+			switch s := sym.(type) {
+			case RuleRef:
+				expr[j] = symbolJSON{Type: "variable", Value: s.Variable.String()}
+			case Terminal:
+				expr[j] = symbolJSON{Type: "kind", Value: s.String()}
+			case Literal:
+				expr[j] = symbolJSON{Type: "literal", Value: s.String()}
+			case CharClass:
+				expr[j] = symbolJSON{Type: "class", Value: s.String()}
+			default:
+				return nil, fmt.Errorf("Unknown symbol '%v' in rule %d", sym, i)
+			}
+		}
+		res.Rules[i] = ruleJSON{Variable: rule.Variable, Expr: expr, Label: rule.Label, Annotations: rule.Annotations}
+	}
+	return json.Marshal(res)
+}
+
+// UnmarshalJSON replaces g by the grammar of a JSON object written by
+// MarshalJSON, checking its start variable is defined and its terminals, token
+// kinds and variables agree with its rules
+func (g *Grammar) UnmarshalJSON(data []byte) error {
+	var in grammarJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	rules := make([]Rule, len(in.Rules))
+	for i, rule := range in.Rules {
+		expr := make(Expr, len(rule.Expr))
+		for j, sym := range rule.Expr {
+			switch sym.Type {
+			case "variable":
+				expr[j] = Ref(Variable(sym.Value))
+			case "kind":
+				expr[j] = Terminal(sym.Value)
+			case "literal":
+				expr[j] = Literal(sym.Value)
+			case "class":
+				expr[j] = CharClass(sym.Value)
+			default:
+				return fmt.Errorf("Unknown symbol type '%s' in rule %d", sym.Type, i)
+			}
+		}
+		rules[i] = Rule{Variable: rule.Variable, Expr: expr, Label: rule.Label, Annotations: rule.Annotations}
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("Grammar has no rules")
+	}
+	opts := []GrammarOption{WithName(in.Name)}
+	if in.Start != "" {
+		opts = append(opts, WithStart(in.Start))
+	}
+	h, err := NewGrammar(rules, opts...)
+	if err != nil {
+		return err
+	}
+	if !sameElements(in.Variables, h.Variables.Data) {
+		return fmt.Errorf("Variables %v do not match the rules, expected %v", in.Variables, h.Variables.Data)
+	}
+	terminals := slices.DeleteFunc(slices.Clone(h.Terminals.Data), func(t Terminal) bool { return t == EndOfInput })
+	if !sameElements(in.Terminals, terminals) {
+		return fmt.Errorf("Terminals %v do not match the rules, expected %v", in.Terminals, terminals)
+	}
+	if !sameElements(in.Kinds, h.Kinds()) {
+		return fmt.Errorf("Token kinds %v do not match the rules, expected %v", in.Kinds, h.Kinds())
+	}
+	*g = *h
+	return nil
+}
+
+// sameElements returns whether a and b hold the same elements, in any order
+func sameElements[T ~string](a, b []T) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
@@ -0,0 +1,201 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+// golden compares got against the file testdata/name, rewriting it with -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("WriteFile(%s) unexpected error: %v", path, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) unexpected error: %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file\n%s\nwant\n%s", name, got, want)
+	}
+}
+
+// sameGrammar reports whether g and h have the same name, start variable and
+// rules in the same order
+func sameGrammar(g, h *Grammar) bool {
+	return g.Name == h.Name && g.StartVariable() == h.StartVariable() &&
+		slices.EqualFunc(g.Rules, h.Rules, func(a, b *Rule) bool {
+			return a.Variable == b.Variable && slices.Equal(a.Expr, b.Expr) &&
+				a.Label == b.Label && maps.Equal(a.Annotations, b.Annotations)
+		})
+}
+
+func TestMarshal(t *testing.T) {
+	load := func(path string) func() (*Grammar, error) {
+		return func() (*Grammar, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return ParseGrammar(f)
+		}
+	}
+	tests := []struct {
+		name    string
+		grammar func() (*Grammar, error)
+	}{
+		{name: "arithmetic", grammar: load("../examples/arithmetic.bnf")},
+		{name: "json", grammar: load("../examples/json.bnf")},
+		{name: "palindromes", grammar: load("../examples/palindromes.bnf")},
+		{
+			name: "arithmetic-cnf",
+			grammar: func() (*Grammar, error) {
+				g, err := load("../examples/arithmetic.bnf")()
+				if err != nil {
+					return nil, err
+				}
+				return g.ToCNF()
+			},
+		},
+		{
+			name: "interleaved",
+			grammar: func() (*Grammar, error) {
+				return NewGrammar([]Rule{
+					NewRule("S", Expr{Ref("A"), Terminal("ID"), Literal("\\'\n")}),
+					NewRule("A", Expr{}),
+					NewRule("S", Expr{Literal("x")}),
+					NewRule("A", Expr{Ref("A"), Ref("S")}),
+				})
+			},
+		},
+		{
+			name: "classes",
+			grammar: func() (*Grammar, error) {
+				return NewGrammar([]Rule{
+					NewRule("Ident", Expr{CharClass("[a-zA-Z_]"), Ref("Rest")}),
+					NewRule("Rest", Expr{CharClass(`[\w']`), Ref("Rest")}),
+					NewRule("Rest", Expr{}),
+					NewRule("Other", Expr{CharClass(`\p{L}`), CharClass(`[^\]\\]`), Literal("[")}),
+				})
+			},
+		},
+		{
+			name: "annotated",
+			grammar: func() (*Grammar, error) {
+				return NewGrammar([]Rule{
+					{Variable: "T", Expr: Expr{Literal("1")}, Label: "Num", Annotations: map[string]string{"doc": "a digit"}},
+					{Variable: "E", Expr: Expr{Ref("E"), Literal("+"), Ref("T")}, Label: "Add", Annotations: map[string]string{"prec": "1", "assoc": "left"}},
+					{Variable: "E", Expr: Expr{Ref("T")}, Label: "unit rule"},
+				}, WithStart("E"), WithName("Sums"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := tt.grammar()
+			if err != nil {
+				t.Fatalf("grammar unexpected error: %v", err)
+			}
+
+			text, err := g.MarshalText()
+			if err != nil {
+				t.Fatalf("MarshalText() unexpected error: %v", err)
+			}
+			golden(t, tt.name+".bnf", text)
+			var fromText Grammar
+			if err := fromText.UnmarshalText(text); err != nil {
+				t.Fatalf("UnmarshalText() unexpected error: %v", err)
+			}
+			if !sameGrammar(g, &fromText) {
+				t.Errorf("UnmarshalText() grammar\n%s\nwant\n%s", &fromText, g)
+			}
+
+			data, err := json.MarshalIndent(g, "", "  ")
+			if err != nil {
+				t.Fatalf("MarshalJSON() unexpected error: %v", err)
+			}
+			golden(t, tt.name+".json", append(data, '\n'))
+			var fromJSON Grammar
+			if err := json.Unmarshal(data, &fromJSON); err != nil {
+				t.Fatalf("UnmarshalJSON() unexpected error: %v", err)
+			}
+			if !sameGrammar(g, &fromJSON) {
+				t.Errorf("UnmarshalJSON() grammar\n%s\nwant\n%s", &fromJSON, g)
+			}
+		})
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+	}{
+		{name: "variable not an identifier", rules: []Rule{NewRule("S S", Expr{Literal("a")})}},
+		{name: "token kind not an identifier", rules: []Rule{NewRule("S", Expr{Terminal("+")})}},
+		{name: "token kind also a variable", rules: []Rule{NewRule("S", Expr{Terminal("S")})}},
+		{name: "class without a grammar file syntax", rules: []Rule{NewRule("S", Expr{CharClass(".")})}},
+		{name: "annotation key not an identifier", rules: []Rule{{Variable: "S", Expr: Expr{Literal("a")}, Annotations: map[string]string{"a b": "c"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			if text, err := g.MarshalText(); err == nil {
+				t.Errorf("MarshalText() = %q, expected error", text)
+			}
+		})
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "unknown symbol type",
+			data: `{"start": "S", "terminals": [], "variables": ["S"], "rules": [{"variable": "S", "expr": [{"type": "regex", "value": "a"}]}]}`,
+		},
+		{
+			name: "undefined start",
+			data: `{"start": "T", "terminals": ["a"], "variables": ["S"], "rules": [{"variable": "S", "expr": [{"type": "literal", "value": "a"}]}]}`,
+		},
+		{
+			name: "missing variable",
+			data: `{"start": "S", "terminals": [], "variables": ["S"], "rules": [{"variable": "S", "expr": [{"type": "variable", "value": "T"}]}]}`,
+		},
+		{
+			name: "terminals do not match",
+			data: `{"start": "S", "terminals": ["b"], "variables": ["S"], "rules": [{"variable": "S", "expr": [{"type": "literal", "value": "a"}]}]}`,
+		},
+		{
+			name: "no rules",
+			data: `{"start": "S", "terminals": [], "variables": [], "rules": []}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g Grammar
+			if err := json.NewDecoder(strings.NewReader(tt.data)).Decode(&g); err == nil {
+				t.Errorf("UnmarshalJSON() expected error, got\n%s", &g)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// epsilonOrigins returns for each nullable variable the origin of one of its derivations of ε
+func (g *Grammar) epsilonOrigins() map[Variable][]template {
+	eps := make(map[Variable][]template)
+	for changed := true; changed; {
+		changed = false
+	nextRule:
+		for i, rule := range g.Rules {
+			if _, ok := eps[rule.Variable]; ok {
+				continue
+			}
+			var args []template
+			for _, sym := range rule.Expr {
+				ref, ok := sym.(RuleRef)
+				if !ok {
+					continue nextRule
+				}
+				origin, ok := eps[ref.Variable]
+				if !ok {
+					continue nextRule
+				}
+				args = append(args, origin...)
+			}
+			eps[rule.Variable] = []template{tApply{rule: i, args: args}}
+			changed = true
+		}
+	}
+	return eps
+}
+
+// RemoveEpsilon removes every ε-rule, replacing each rule by its variants
+// omitting nullable variables. The result derives the language of g without ε.
+func (g *Grammar) RemoveEpsilon() (*Grammar, error) {
+	return g.removeEpsilon(false)
+}
+
+// removeEpsilon replaces every rule by its variants omitting nullable variables
+// and drops all ε-rules, except for the start variable if keepStart is set
+func (g *Grammar) removeEpsilon(keepStart bool) (*Grammar, error) {
+	eps := g.epsilonOrigins()
+	var rules []derivedRule
+	for i, rule := range g.Rules {
+		var nullable []int
+		for j, sym := range rule.Expr {
+			if ref, ok := sym.(RuleRef); ok {
+				if _, ok := eps[ref.Variable]; ok {
+					nullable = append(nullable, j)
+				}
+			}
+		}
+
+		// Every subset of the nullable positions is omitted in one variant
+		for mask := 0; mask < 1<<len(nullable); mask++ {
+			origin := identityOrigin(i, len(rule.Expr))
+			omit := make(map[int]bool)
+			for b := len(nullable) - 1; b >= 0; b-- {
+				if mask&(1<<b) != 0 {
+					pos := nullable[b]
+					omit[pos] = true
+					origin = substitute(origin, pos, eps[rule.Expr[pos].(RuleRef).Variable], 0)
+				}
+			}
+			var expr Expr
+			for j, sym := range rule.Expr {
+				if !omit[j] {
+					expr = append(expr, sym)
+				}
+			}
+			if len(expr) == 0 && !(keepStart && rule.Variable == g.StartVariable()) {
+				continue
+			}
+			rules = append(rules, derivedRule{
+				Rule:   rule.derived(rule.Variable, expr),
+				origin: origin,
+			})
+		}
+	}
+	return g.derive("remove ε-rules", g.StartVariable(), rules)
+}
+
+// RemoveUnit replaces every chain of unit rules A -> B -> ... -> C by copies of
+// the non-unit rules of C for A. The language is preserved and the result has
+// no unit rules, hence no cycles if g has no ε-rules.
+func (g *Grammar) RemoveUnit() (*Grammar, error) {
+	var rules []derivedRule
+	for _, v := range g.Variables.Data {
+		// Variables reachable from v through unit rules with the origin of the chain
+		chains := map[Variable][]template{v: nil}
+		queue := []Variable{v}
+		for len(queue) > 0 {
+			u := queue[0]
+			queue = queue[1:]
+			for i, rule := range g.Rules {
+				if rule.Variable != u {
+					continue
+				}
+				if ref, ok := unitRule(rule); ok {
+					if _, seen := chains[ref]; !seen {
+						chains[ref] = chainOrigin(chains[u], identityOrigin(i, 1), 1)
+						queue = append(queue, ref)
+					}
+					continue
+				}
+				rules = append(rules, derivedRule{
+					Rule:   rule.derived(v, append(Expr{}, rule.Expr...)),
+					origin: chainOrigin(chains[u], identityOrigin(i, len(rule.Expr)), len(rule.Expr)),
+				})
+			}
+		}
+	}
+	return g.derive("remove unit rules", g.StartVariable(), rules)
+}
+
+// chainOrigin extends the origin of a unit chain by a rule with n symbols
+func chainOrigin(chain []template, origin []template, n int) []template {
+	if chain == nil {
+		return origin
+	}
+	return substitute(chain, 0, origin, n)
+}
+
+func unitRule(rule *Rule) (Variable, bool) {
+	if len(rule.Expr) != 1 {
+		return "", false
+	}
+	ref, ok := rule.Expr[0].(RuleRef)
+	return ref.Variable, ok
+}
+
+// RemoveCycles merges the variables deriving each other through unit rules, so
+// no variable derives itself in one or more steps. The language is preserved.
+// Cycles through nullable variables, like A -> A B with B =>* ε, cannot be
+// merged away and are reported as an error, RemoveEpsilon removes them.
+func (g *Grammar) RemoveCycles() (*Grammar, error) {
+	nullable := g.FirstFollow().Nullable
+	scc := stronglyConnected(g.Variables.Data, g.singleDerivations(nullable))
+	for _, rule := range g.Rules {
+		if len(rule.Expr) < 2 {
+			continue
+		}
+		for i, sym := range rule.Expr {
+			if ref, ok := sym.(RuleRef); ok && scc[ref.Variable] == scc[rule.Variable] && derivesAlone(rule, i, nullable) {
+				return nil, fmt.Errorf("Variable '%s' derives itself through nullable variables in \"%s\"", rule.Variable, strings.TrimSpace(rule.String()))
+			}
+		}
+	}
+
+	// Every variable is replaced by the first variable of its component, which
+	// derives it through a chain of unit rules inside the component
+	rep := make(map[int]Variable)
+	for _, v := range g.Variables.Data {
+		if _, ok := rep[scc[v]]; !ok {
+			rep[scc[v]] = v
+		}
+	}
+	chain := func(from, to Variable) []template {
+		chains := map[Variable][]template{from: nil}
+		queue := []Variable{from}
+		for len(queue) > 0 && chains[to] == nil && from != to {
+			u := queue[0]
+			queue = queue[1:]
+			for i, rule := range g.Rules {
+				ref, ok := unitRule(rule)
+				if !ok || rule.Variable != u || scc[ref] != scc[u] {
+					continue
+				}
+				if _, seen := chains[ref]; !seen {
+					chains[ref] = chainOrigin(chains[u], identityOrigin(i, 1), 1)
+					queue = append(queue, ref)
+				}
+			}
+		}
+		return chains[to]
+	}
+
+	var rules []derivedRule
+	for i, rule := range g.Rules {
+		if ref, ok := unitRule(rule); ok && scc[ref] == scc[rule.Variable] {
+			continue
+		}
+		origin := identityOrigin(i, len(rule.Expr))
+		expr := make(Expr, len(rule.Expr))
+		for j, sym := range rule.Expr {
+			expr[j] = sym
+			if ref, ok := sym.(RuleRef); ok && rep[scc[ref.Variable]] != ref.Variable {
+				r := rep[scc[ref.Variable]]
+				expr[j] = Ref(r)
+				origin = substitute(origin, j, chain(ref.Variable, r), 1)
+			}
+		}
+		v := rep[scc[rule.Variable]]
+		rules = append(rules, derivedRule{
+			Rule:   rule.derived(v, expr),
+			origin: chainOrigin(chain(v, rule.Variable), origin, len(expr)),
+		})
+	}
+	return g.derive("remove cycles", g.StartVariable(), rules)
+}
+
+// derivation is an edge of a graph between variables, labelled by the rule of
+// the source variable it goes through
+type derivation struct {
+	rule int
+	to   Variable
+}
+
+// singleDerivations returns for every variable the variables it can be
+// rewritten to in one step with every other symbol of the rule deriving ε
+func (g *Grammar) singleDerivations(nullable map[Variable]bool) map[Variable][]derivation {
+	edges := make(map[Variable][]derivation)
+	for r, rule := range g.Rules {
+		for i, sym := range rule.Expr {
+			if ref, ok := sym.(RuleRef); ok && derivesAlone(rule, i, nullable) {
+				edges[rule.Variable] = append(edges[rule.Variable], derivation{rule: r, to: ref.Variable})
+			}
+		}
+	}
+	return edges
+}
+
+// isCyclic returns whether some variable derives itself in one or more steps
+func (g *Grammar) isCyclic() bool {
+	return len(witnesses(g.Variables.Data, g.singleDerivations(g.FirstFollow().Nullable))) > 0
+}
+
+// derivesAlone returns whether every symbol of rule but the one at i derives ε
+func derivesAlone(rule *Rule, i int, nullable map[Variable]bool) bool {
+	for j, sym := range rule.Expr {
+		if ref, ok := sym.(RuleRef); j != i && (!ok || !nullable[ref.Variable]) {
+			return false
+		}
+	}
+	return true
+}
+
+// stronglyConnected returns for every variable the index of its strongly
+// connected component in the graph of edges
+func stronglyConnected(variables []Variable, edges map[Variable][]derivation) map[Variable]int {
+	index := make(map[Variable]int)
+	low := make(map[Variable]int)
+	onStack := make(map[Variable]bool)
+	var stack []Variable
+	comp := make(map[Variable]int)
+	count := 0
+
+	var visit func(v Variable)
+	visit = func(v Variable) {
+		index[v] = len(index)
+		low[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, e := range edges[v] {
+			w := e.to
+			if _, ok := index[w]; !ok {
+				visit(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+		}
+		if low[v] == index[v] {
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				comp[w] = count
+				if w == v {
+					break
+				}
+			}
+			count++
+		}
+	}
+	for _, v := range variables {
+		if _, ok := index[v]; !ok {
+			visit(v)
+		}
+	}
+	return comp
+}
+
+// productiveVariables returns the variables deriving at least one string of terminals
+func (g *Grammar) productiveVariables() map[Variable]bool {
+	productive := make(map[Variable]bool)
+	for changed := true; changed; {
+		changed = false
+	nextRule:
+		for _, rule := range g.Rules {
+			if productive[rule.Variable] {
+				continue
+			}
+			for _, sym := range rule.Expr {
+				if ref, ok := sym.(RuleRef); ok && !productive[ref.Variable] {
+					continue nextRule
+				}
+			}
+			productive[rule.Variable] = true
+			changed = true
+		}
+	}
+	return productive
+}
+
+// reachableVariables returns the variables occurring in some sentential form of g
+func (g *Grammar) reachableVariables() map[Variable]bool {
+	reachable := map[Variable]bool{g.StartVariable(): true}
+	queue := []Variable{g.StartVariable()}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, expr := range g.RulesMap[v] {
+			for _, sym := range *expr {
+				if ref, ok := sym.(RuleRef); ok && !reachable[ref.Variable] {
+					reachable[ref.Variable] = true
+					queue = append(queue, ref.Variable)
+				}
+			}
+		}
+	}
+	return reachable
+}
+
+// RemoveUnproductive removes the variables deriving no string of terminals and
+// every rule using them. The language is preserved, an error is returned if the
+// start variable itself is unproductive.
+func (g *Grammar) RemoveUnproductive() (*Grammar, error) {
+	productive := g.productiveVariables()
+	var rules []derivedRule
+	for _, rule := range g.identityRules() {
+		if productive[rule.Variable] {
+			rules = append(rules, rule)
+		}
+	}
+	// Rules referencing removed variables are dropped by derive
+	return g.derive("remove unproductive variables", g.StartVariable(), rules)
+}
+
+// RemoveUnreachable removes the variables that do not occur in any sentential
+// form derived from the start variable. The language is preserved.
+func (g *Grammar) RemoveUnreachable() (*Grammar, error) {
+	reachable := g.reachableVariables()
+	var rules []derivedRule
+	for _, rule := range g.identityRules() {
+		if reachable[rule.Variable] {
+			rules = append(rules, rule)
+		}
+	}
+	return g.derive("remove unreachable variables", g.StartVariable(), rules)
+}
+
+// RemoveUseless removes the unproductive then the unreachable variables, leaving
+// only variables used in some derivation of a string of terminals
+func (g *Grammar) RemoveUseless() (*Grammar, error) {
+	h, err := g.RemoveUnproductive()
+	if err != nil {
+		return nil, err
+	}
+	return h.RemoveUnreachable()
+}
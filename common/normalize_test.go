@@ -0,0 +1,348 @@
+package common
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// language returns the strings of at most n bytes g derives
+func language(g *Grammar, n int) map[string]bool {
+	lang := make(map[Variable]map[string]bool)
+	for _, v := range g.Variables.Data {
+		lang[v] = make(map[string]bool)
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range g.Rules {
+			strs := map[string]bool{"": true}
+			for _, sym := range rule.Expr {
+				next := make(map[string]bool)
+				var options []string
+				if t, ok := TerminalOf(sym); ok {
+					options = []string{t.String()}
+				} else {
+					options = slices.Collect(maps.Keys(lang[sym.(RuleRef).Variable]))
+				}
+				for s := range strs {
+					for _, o := range options {
+						if len(s)+len(o) <= n {
+							next[s+o] = true
+						}
+					}
+				}
+				strs = next
+			}
+			for s := range strs {
+				if !lang[rule.Variable][s] {
+					lang[rule.Variable][s] = true
+					changed = true
+				}
+			}
+		}
+	}
+	return lang[g.StartVariable()]
+}
+
+// derivations returns the parse trees of v in g of height at most depth
+func derivations(g *Grammar, v Variable, depth int) []*ParseTree {
+	if depth == 0 {
+		return nil
+	}
+	var res []*ParseTree
+	for i, rule := range g.Rules {
+		if rule.Variable != v {
+			continue
+		}
+		partial := [][]*ParseTree{{}}
+		for _, sym := range rule.Expr {
+			var options []*ParseTree
+			if _, ok := TerminalOf(sym); ok {
+				options = []*ParseTree{NewLeaf(sym, Span{})}
+			} else {
+				options = derivations(g, sym.(RuleRef).Variable, depth-1)
+			}
+			var next [][]*ParseTree
+			for _, children := range partial {
+				for _, o := range options {
+					next = append(next, append(slices.Clone(children), o))
+				}
+			}
+			partial = next
+		}
+		for _, children := range partial {
+			res = append(res, &ParseTree{Rule: i, Variable: v, Children: children})
+		}
+	}
+	return res
+}
+
+// validTree checks that every node of tree applies a rule of g to matching children
+func validTree(g *Grammar, tree *ParseTree) error {
+	var err error
+	tree.Walk(func(node *ParseTree) bool {
+		if node.IsLeaf() || err != nil {
+			return false
+		}
+		rule := g.Rules[node.Rule]
+		if rule.Variable != node.Variable || len(rule.Expr) != len(node.Children) {
+			err = fmt.Errorf("node %s (%d) does not match %s", node.Variable, node.Rule, rule.String())
+			return false
+		}
+		for i, sym := range rule.Expr {
+			child := node.Children[i]
+			if t, ok := TerminalOf(sym); ok {
+				if ct, _ := TerminalOf(child.Terminal); !child.IsLeaf() || ct != t {
+					err = fmt.Errorf("child %d of %s does not match %s", i, node.Variable, rule.String())
+				}
+			} else if child.IsLeaf() || child.Variable != sym.(RuleRef).Variable {
+				err = fmt.Errorf("child %d of %s does not match %s", i, node.Variable, rule.String())
+			}
+		}
+		return true
+	})
+	return err
+}
+
+func yield(tree *ParseTree) string {
+	var sb strings.Builder
+	tree.Walk(func(node *ParseTree) bool {
+		if node.IsLeaf() {
+			t, _ := TerminalOf(node.Terminal)
+			sb.WriteString(t.String())
+		}
+		return true
+	})
+	return sb.String()
+}
+
+func TestNormalize(t *testing.T) {
+	nullableRules := []Rule{
+		NewRule("S", Expr{Ref("A"), Literal("b"), Ref("A")}),
+		NewRule("S", Expr{}),
+		NewRule("A", Expr{Literal("a"), Ref("A")}),
+		NewRule("A", Expr{}),
+	}
+	unitRules := []Rule{
+		NewRule("S", Expr{Ref("A")}),
+		NewRule("S", Expr{Literal("s")}),
+		NewRule("A", Expr{Ref("B")}),
+		NewRule("A", Expr{Literal("a"), Ref("S")}),
+		NewRule("B", Expr{Ref("S")}),
+		NewRule("B", Expr{Literal("b")}),
+		NewRule("B", Expr{Ref("B")}),
+	}
+	uselessRules := []Rule{
+		NewRule("S", Expr{Literal("a"), Ref("S")}),
+		NewRule("S", Expr{Ref("A")}),
+		NewRule("S", Expr{Ref("B"), Literal("b")}),
+		NewRule("A", Expr{Literal("a")}),
+		NewRule("B", Expr{Literal("b"), Ref("B")}),
+		NewRule("C", Expr{Literal("c")}),
+		NewRule("D", Expr{Ref("B")}),
+	}
+
+	// check returns a description of the first rule violating the property the transformation establishes
+	noEpsilon := func(h *Grammar) string {
+		for _, rule := range h.Rules {
+			if len(rule.Expr) == 0 {
+				return rule.String()
+			}
+		}
+		return ""
+	}
+	noUnit := func(h *Grammar) string {
+		for _, rule := range h.Rules {
+			if _, ok := unitRule(rule); ok {
+				return rule.String()
+			}
+		}
+		return ""
+	}
+	noCycles := func(h *Grammar) string {
+		units := make(map[Variable][]derivation)
+		for r, rule := range h.Rules {
+			if v, ok := unitRule(rule); ok {
+				if v == rule.Variable {
+					return rule.String()
+				}
+				units[rule.Variable] = append(units[rule.Variable], derivation{rule: r, to: v})
+			}
+		}
+		scc := stronglyConnected(h.Variables.Data, units)
+		for _, v := range h.Variables.Data {
+			for _, e := range units[v] {
+				if scc[v] == scc[e.to] {
+					return fmt.Sprintf("%s and %s derive each other", v, e.to)
+				}
+			}
+		}
+		return ""
+	}
+	allProductive := func(h *Grammar) string {
+		productive := h.productiveVariables()
+		for _, v := range h.Variables.Data {
+			if !productive[v] {
+				return v.String()
+			}
+		}
+		return ""
+	}
+	allReachable := func(h *Grammar) string {
+		reachable := h.reachableVariables()
+		for _, v := range h.Variables.Data {
+			if !reachable[v] {
+				return v.String()
+			}
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name      string
+		rules     []Rule
+		transform func(g *Grammar) (*Grammar, error)
+		check     func(h *Grammar) string
+		// dropsEpsilon tells that the language loses ε
+		dropsEpsilon bool
+		expectError  bool
+	}{
+		{
+			name:         "remove epsilon",
+			rules:        nullableRules,
+			transform:    (*Grammar).RemoveEpsilon,
+			check:        noEpsilon,
+			dropsEpsilon: true,
+		},
+		{
+			name:      "remove unit",
+			rules:     unitRules,
+			transform: (*Grammar).RemoveUnit,
+			check:     noUnit,
+		},
+		{
+			name:      "remove cycles",
+			rules:     unitRules,
+			transform: (*Grammar).RemoveCycles,
+			check:     noCycles,
+		},
+		{
+			name: "remove cycles keeps acyclic unit rules",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A")}),
+				NewRule("A", Expr{Ref("B")}),
+				NewRule("A", Expr{Literal("a")}),
+				NewRule("B", Expr{Literal("b")}),
+			},
+			transform: (*Grammar).RemoveCycles,
+			check:     noCycles,
+		},
+		{
+			name: "remove cycles through nullable variables",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("S"), Ref("A")}),
+				NewRule("S", Expr{Literal("s")}),
+				NewRule("A", Expr{}),
+			},
+			transform:   (*Grammar).RemoveCycles,
+			expectError: true,
+		},
+		{
+			name:      "remove unproductive",
+			rules:     uselessRules,
+			transform: (*Grammar).RemoveUnproductive,
+			check:     allProductive,
+		},
+		{
+			name: "remove unproductive start",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Ref("S")}),
+			},
+			transform:   (*Grammar).RemoveUnproductive,
+			expectError: true,
+		},
+		{
+			name:      "remove unreachable",
+			rules:     uselessRules,
+			transform: (*Grammar).RemoveUnreachable,
+			check:     allReachable,
+		},
+		{
+			name:      "remove useless",
+			rules:     uselessRules,
+			transform: (*Grammar).RemoveUseless,
+			check: func(h *Grammar) string {
+				return allProductive(h) + allReachable(h)
+			},
+		},
+		{
+			name:  "chained",
+			rules: append(slices.Clone(nullableRules), NewRule("S", Expr{Ref("S")}), NewRule("B", Expr{Literal("b")})),
+			transform: func(g *Grammar) (*Grammar, error) {
+				h, err := g.RemoveEpsilon()
+				if err != nil {
+					return nil, err
+				}
+				if h, err = h.RemoveCycles(); err != nil {
+					return nil, err
+				}
+				if h, err = h.RemoveUnit(); err != nil {
+					return nil, err
+				}
+				return h.RemoveUseless()
+			},
+			check: func(h *Grammar) string {
+				return noEpsilon(h) + noUnit(h) + allProductive(h) + allReachable(h)
+			},
+			dropsEpsilon: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			h, err := tt.transform(g)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("transformation expected error but got none:\n%s", h)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("transformation unexpected error: %v", err)
+			}
+			if violation := tt.check(h); violation != "" {
+				t.Errorf("transformation left %s in\n%s", violation, h)
+			}
+			if h.Original() != g {
+				t.Errorf("Original() does not return the source grammar")
+			}
+
+			expected := language(g, 6)
+			if tt.dropsEpsilon {
+				delete(expected, "")
+			}
+			if got := language(h, 6); !maps.Equal(got, expected) {
+				t.Errorf("transformation derives %v, want %v", slices.Sorted(maps.Keys(got)), slices.Sorted(maps.Keys(expected)))
+			}
+
+			for _, tree := range derivations(h, h.StartVariable(), 4) {
+				folded, err := h.FoldTo(tree, g)
+				if err != nil {
+					t.Fatalf("FoldTo() unexpected error: %v\n%s", err, tree)
+				}
+				if err := validTree(g, folded); err != nil {
+					t.Fatalf("FoldTo() invalid tree: %v\n%s", err, folded)
+				}
+				if yield(folded) != yield(tree) {
+					t.Fatalf("FoldTo() yields %q, want %q", yield(folded), yield(tree))
+				}
+			}
+		})
+	}
+}
@@ -1,5 +1,41 @@
 package common
 
+// Parser produces a left parse (the rule numbers of a leftmost derivation) of its input.
+// Parsers are safe for concurrent use, parses keeping their state to themselves.
 type Parser interface {
+	// Parse parses raw input, terminals are matched literally against it
 	Parse(input string) ([]int, error)
+	// ParseTokens parses a token stream, terminals are matched against token kinds
+	ParseTokens(tokens []Token) ([]int, error)
+}
+
+// TreeParser is a Parser that can also build parse trees directly
+type TreeParser interface {
+	Parser
+	ParseTree(input string) (*ParseTree, error)
+	ParseTokensTree(tokens []Token) (*ParseTree, error)
+}
+
+// ForestParser is a TreeParser that can also build a forest of every derivation of its input
+type ForestParser interface {
+	TreeParser
+	ParseForest(input string) (*Forest, error)
+	ParseTokensForest(tokens []Token) (*Forest, error)
+}
+
+// RecoveringParser is a ForestParser that can also recover from syntax errors,
+// returning a best-effort parse tree with error leaves and every error found.
+// The tree is nil if the input could not be repaired.
+type RecoveringParser interface {
+	ForestParser
+	ParseRecover(input string) (*ParseTree, []*ParseError)
+	ParseTokensRecover(tokens []Token) (*ParseTree, []*ParseError)
+}
+
+// RightParser is a TreeParser that can also produce a right parse, the rule
+// numbers of a rightmost derivation in the order a bottom-up parser reduces them
+type RightParser interface {
+	TreeParser
+	ParseRight(input string) ([]int, error)
+	ParseTokensRight(tokens []Token) ([]int, error)
 }
@@ -0,0 +1,228 @@
+package common
+
+import (
+	"fmt"
+)
+
+// template describes the fragment of a derivation in the source grammar of a
+// transformation that one rule of the transformed grammar stands for.
+// A rule's origin is a list of templates, evaluating it against the children of
+// a node of the transformed grammar gives the list of source subtrees the node
+// stands for.
+type template interface {
+	isTemplate()
+}
+
+// tApply applies a source rule to the subtrees its arguments evaluate to
+type tApply struct {
+	rule int
+	args []template
+}
+
+// tHole is the folded subtree(s) of a child of the transformed node
+type tHole int
+
+// tAcc is the subtree accumulated by an enclosing tPass
+type tAcc struct{}
+
+// tPass folds a child of the transformed node with acc as its accumulated
+// subtree, used to rotate right-recursive tails back into left recursion
+type tPass struct {
+	hole int
+	acc  template
+}
+
+func (tApply) isTemplate() {}
+func (tHole) isTemplate()  {}
+func (tAcc) isTemplate()   {}
+func (tPass) isTemplate()  {}
+
+// identityOrigin is the origin of a rule copied unchanged from the source rule
+func identityOrigin(rule int, n int) []template {
+	args := make([]template, n)
+	for i := range args {
+		args[i] = tHole(i)
+	}
+	return []template{tApply{rule: rule, args: args}}
+}
+
+// spliceOrigin is the origin of a synthesized rule standing for its children
+func spliceOrigin(n int) []template {
+	origin := make([]template, n)
+	for i := range origin {
+		origin[i] = tHole(i)
+	}
+	return origin
+}
+
+// substitute replaces the hole h of an origin by repl, the origin of a rule with
+// n symbols replacing the symbol at h. Holes of repl are shifted to h, following
+// holes by n-1.
+func substitute(origin []template, h int, repl []template, n int) []template {
+	repl = shiftHoles(repl, h)
+	res := make([]template, 0, len(origin))
+	for _, t := range origin {
+		res = append(res, substituteOne(t, h, repl, n)...)
+	}
+	return res
+}
+
+func shiftHoles(ts []template, by int) []template {
+	res := make([]template, 0, len(ts))
+	for _, t := range ts {
+		switch v := t.(type) {
+		case tApply:
+			res = append(res, tApply{rule: v.rule, args: shiftHoles(v.args, by)})
+		case tHole:
+			res = append(res, tHole(int(v)+by))
+		case tPass:
+			res = append(res, tPass{hole: v.hole + by, acc: shiftHoles([]template{v.acc}, by)[0]})
+		default:
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+func substituteOne(t template, h int, repl []template, n int) []template {
+	switch v := t.(type) {
+	case tApply:
+		args := make([]template, 0, len(v.args))
+		for _, arg := range v.args {
+			args = append(args, substituteOne(arg, h, repl, n)...)
+		}
+		return []template{tApply{rule: v.rule, args: args}}
+	case tHole:
+		if int(v) == h {
+			return repl
+		}
+		if int(v) > h {
+			return []template{tHole(int(v) + n - 1)}
+		}
+		return []template{v}
+	case tPass:
+		acc := substituteOne(v.acc, h, repl, n)[0]
+		if v.hole == h {
+			// The replacing rule continues the accumulated subtree
+			return replaceAcc(repl, acc)
+		}
+		hole := v.hole
+		if hole > h {
+			hole += n - 1
+		}
+		return []template{tPass{hole: hole, acc: acc}}
+	}
+	return []template{t}
+}
+
+func replaceAcc(ts []template, acc template) []template {
+	res := make([]template, 0, len(ts))
+	for _, t := range ts {
+		switch v := t.(type) {
+		case tAcc:
+			res = append(res, acc)
+		case tApply:
+			res = append(res, tApply{rule: v.rule, args: replaceAcc(v.args, acc)})
+		case tPass:
+			res = append(res, tPass{hole: v.hole, acc: replaceAcc([]template{v.acc}, acc)[0]})
+		default:
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// Fold maps a parse tree of a transformed grammar to the equivalent parse tree
+// of the grammar it was transformed from
+func (g *Grammar) Fold(tree *ParseTree) (*ParseTree, error) {
+	if g.Source == nil {
+		return nil, fmt.Errorf("Grammar is not the result of a transformation")
+	}
+	trees, err := g.fold(tree, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(trees) != 1 {
+		return nil, fmt.Errorf("Tree folds into %d trees, expected 1", len(trees))
+	}
+	trees[0].RecomputeSpans(tree.Span.Start)
+	return trees[0], nil
+}
+
+// FoldTo folds a parse tree of g through the chain of transformations up to target
+func (g *Grammar) FoldTo(tree *ParseTree, target *Grammar) (*ParseTree, error) {
+	for h := g; h != target; h = h.Source {
+		if h == nil {
+			return nil, fmt.Errorf("Grammar was not transformed from the target grammar")
+		}
+		var err error
+		if tree, err = h.Fold(tree); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// Original returns the grammar at the start of the chain of transformations g was derived from
+func (g *Grammar) Original() *Grammar {
+	for g.Source != nil {
+		g = g.Source
+	}
+	return g
+}
+
+func (g *Grammar) fold(node *ParseTree, acc *ParseTree) ([]*ParseTree, error) {
+	if node.IsLeaf() {
+		return []*ParseTree{node}, nil
+	}
+	if node.Rule >= len(g.origins) {
+		return nil, fmt.Errorf("Unexpected rule number '%v', maximum is '%v'", node.Rule, len(g.origins)-1)
+	}
+	return g.eval(g.origins[node.Rule], node, acc)
+}
+
+func (g *Grammar) eval(ts []template, node *ParseTree, acc *ParseTree) ([]*ParseTree, error) {
+	var trees []*ParseTree
+	for _, t := range ts {
+		switch v := t.(type) {
+		case tApply:
+			children, err := g.eval(v.args, node, acc)
+			if err != nil {
+				return nil, err
+			}
+			trees = append(trees, &ParseTree{
+				Rule:     v.rule,
+				Variable: g.Source.Rules[v.rule].Variable,
+				Children: children,
+			})
+		case tHole:
+			if int(v) >= len(node.Children) {
+				return nil, fmt.Errorf("Node of rule '%d' has %d children, expected more", node.Rule, len(node.Children))
+			}
+			children, err := g.fold(node.Children[v], nil)
+			if err != nil {
+				return nil, err
+			}
+			trees = append(trees, children...)
+		case tAcc:
+			if acc == nil {
+				return nil, fmt.Errorf("Node of rule '%d' continues a missing subtree", node.Rule)
+			}
+			trees = append(trees, acc)
+		case tPass:
+			accTrees, err := g.eval([]template{v.acc}, node, acc)
+			if err != nil {
+				return nil, err
+			}
+			if v.hole >= len(node.Children) || len(accTrees) != 1 {
+				return nil, fmt.Errorf("Node of rule '%d' does not match its origin", node.Rule)
+			}
+			children, err := g.fold(node.Children[v.hole], accTrees[0])
+			if err != nil {
+				return nil, err
+			}
+			trees = append(trees, children...)
+		}
+	}
+	return trees, nil
+}
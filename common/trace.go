@@ -0,0 +1,119 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Tracer receives the steps of parsers, grammar transformations and derivations,
+// to log or visualise them. Nothing is traced unless a Tracer is set. A Tracer
+// shared by parses running at once must be safe for concurrent use.
+type Tracer interface {
+	Trace(event Event)
+}
+
+// TracerFunc adapts a function to a Tracer
+type TracerFunc func(event Event)
+
+func (f TracerFunc) Trace(event Event) {
+	f(event)
+}
+
+// NewLogTracer returns a Tracer writing every event to w on a line of its own
+func NewLogTracer(w io.Writer) Tracer {
+	var mu sync.Mutex
+	return TracerFunc(func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintln(w, event)
+	})
+}
+
+// Event is a step reported to a Tracer, one of PredictEvent, ScanEvent,
+// CompleteEvent, TransformEvent or DeriveEvent
+type Event interface {
+	fmt.Stringer
+	event()
+}
+
+// ChartItem is a dotted rule of a chart parser recognised from Origin to Pos
+type ChartItem struct {
+	// Rule is the index of the rule in the grammar, -1 for the start rule added by
+	// the parser, and Dot the number of symbols recognised
+	Rule int
+	Dot  int
+	// Text shows the rule with the dot
+	Text   string
+	Origin int
+	Pos    int
+}
+
+func (i ChartItem) String() string {
+	return fmt.Sprintf("(%s, %d..%d)", i.Text, i.Origin, i.Pos)
+}
+
+// PredictEvent reports an item added at Pos for a variable expected there
+type PredictEvent struct {
+	ChartItem
+}
+
+func (e PredictEvent) String() string {
+	return "predict " + e.ChartItem.String()
+}
+
+// ScanEvent reports an item advanced over the terminal ending at Pos
+type ScanEvent struct {
+	ChartItem
+	Terminal Terminal
+}
+
+func (e ScanEvent) String() string {
+	return fmt.Sprintf("scan '%s' %s", e.Terminal, e.ChartItem)
+}
+
+// CompleteEvent reports a complete item, its variable being recognised from
+// Origin to Pos
+type CompleteEvent struct {
+	ChartItem
+}
+
+func (e CompleteEvent) String() string {
+	return "complete " + e.ChartItem.String()
+}
+
+// TransformEvent reports a step of a grammar transformation, Grammar being the
+// result of Step on Grammar.Source
+type TransformEvent struct {
+	Step    string
+	Grammar *Grammar
+}
+
+func (e TransformEvent) String() string {
+	return fmt.Sprintf("%s: %d rules, %d variables", e.Step, len(e.Grammar.Rules), len(e.Grammar.Variables.Data))
+}
+
+// DeriveEvent reports a step of a leftmost derivation, Before becoming After by
+// applying the rule numbered Rule
+type DeriveEvent struct {
+	Rule   int
+	Before Expr
+	After  Expr
+}
+
+func (e DeriveEvent) String() string {
+	return fmt.Sprintf("%s-> %s[%d]", e.Before.String(), e.After.String(), e.Rule)
+}
+
+func (PredictEvent) event()   {}
+func (ScanEvent) event()      {}
+func (CompleteEvent) event()  {}
+func (TransformEvent) event() {}
+func (DeriveEvent) event()    {}
+
+// trace reports an event to the tracer of g, if it has one
+func (g *Grammar) trace(event Event) {
+	if g.Tracer != nil {
+		g.Tracer.Trace(event)
+	}
+}
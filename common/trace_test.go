@@ -0,0 +1,73 @@
+package common
+
+import (
+	"slices"
+	"testing"
+)
+
+// recorder returns a tracer appending the events it receives to events
+func recorder(events *[]string) Tracer {
+	return TracerFunc(func(event Event) {
+		*events = append(*events, event.String())
+	})
+}
+
+func TestTraceEvalLeftParse(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("S", Expr{Ref("A"), Ref("A")}),
+		NewRule("A", Expr{Literal("a")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	var events []string
+	g.Tracer = recorder(&events)
+	if _, err := g.EvalLeftParse([]int{0, 1, 1}); err != nil {
+		t.Fatalf("EvalLeftParse() unexpected error: %v", err)
+	}
+	expected := []string{
+		"S -> A A [0]",
+		"A A -> 'a' A [1]",
+		"'a' A -> 'a' 'a' [1]",
+	}
+	if !slices.Equal(events, expected) {
+		t.Errorf("EvalLeftParse() traced %q, want %q", events, expected)
+	}
+}
+
+func TestTraceTransform(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("S", Expr{Literal("a"), Ref("S"), Literal("b")}),
+		NewRule("S", Expr{}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	var steps []string
+	g.Tracer = TracerFunc(func(event Event) {
+		e, ok := event.(TransformEvent)
+		if !ok {
+			t.Fatalf("ToCNF() traced %T, want TransformEvent", event)
+		}
+		steps = append(steps, e.Step)
+	})
+	h, err := g.ToCNF()
+	if err != nil {
+		t.Fatalf("ToCNF() unexpected error: %v", err)
+	}
+	expected := []string{
+		"add start variable",
+		"separate terminals",
+		"binarize",
+		"remove ε-rules",
+		"remove unit rules",
+		"remove unproductive variables",
+		"remove unreachable variables",
+	}
+	if !slices.Equal(steps, expected) {
+		t.Errorf("ToCNF() traced steps %q, want %q", steps, expected)
+	}
+	if h.Tracer == nil {
+		t.Errorf("ToCNF() result does not share the tracer")
+	}
+}
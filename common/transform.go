@@ -0,0 +1,126 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+)
+
+// derivedRule is a rule of a grammar being transformed along with its origin
+type derivedRule struct {
+	Rule
+	origin []template
+}
+
+// identityRules copies the rules of g, each standing for itself
+func (g *Grammar) identityRules() []derivedRule {
+	rules := make([]derivedRule, len(g.Rules))
+	for i, rule := range g.Rules {
+		rules[i] = derivedRule{
+			Rule:   rule.Copy(),
+			origin: identityOrigin(i, len(rule.Expr)),
+		}
+	}
+	return rules
+}
+
+// derive builds the grammar of the transformation step of g with the given start variable
+func (g *Grammar) derive(step string, start Variable, rules []derivedRule) (*Grammar, error) {
+	rules = dropUndefined(dedupRules(rules))
+
+	if !slices.ContainsFunc(rules, func(rule derivedRule) bool { return rule.Variable == start }) {
+		return nil, fmt.Errorf("Grammar derives no strings")
+	}
+	plain := make([]Rule, len(rules))
+	origins := make([][]template, len(rules))
+	for i, rule := range rules {
+		plain[i] = rule.Rule
+		origins[i] = rule.origin
+	}
+	h, err := NewGrammar(plain, WithStart(start), WithName(g.Name))
+	if err != nil {
+		return nil, err
+	}
+	h.Source = g
+	h.Tracer = g.Tracer
+	h.origins = origins
+	h.trace(TransformEvent{Step: step, Grammar: h})
+	return h, nil
+}
+
+// dedupRules removes rules identical to an earlier rule, keeping the first origin
+func dedupRules(rules []derivedRule) []derivedRule {
+	seen := make(map[string]bool)
+	res := make([]derivedRule, 0, len(rules))
+	for _, rule := range rules {
+		key := ruleKey(rule.Rule)
+		if !seen[key] {
+			seen[key] = true
+			res = append(res, rule)
+		}
+	}
+	return res
+}
+
+func ruleKey(rule Rule) string {
+	key := rule.Variable.String() + " ->"
+	for _, sym := range rule.Expr {
+		switch v := sym.(type) {
+		case Literal:
+			key += fmt.Sprintf(" s%q", v)
+		case Terminal:
+			key += fmt.Sprintf(" t%q", v)
+		case CharClass:
+			key += fmt.Sprintf(" c%q", v)
+		case RuleRef:
+			key += fmt.Sprintf(" v%q", v.Variable)
+		}
+	}
+	return key
+}
+
+// dropUndefined removes rules referencing variables left without any rule
+func dropUndefined(rules []derivedRule) []derivedRule {
+	for {
+		defined := make(map[Variable]bool)
+		for _, rule := range rules {
+			defined[rule.Variable] = true
+		}
+		res := make([]derivedRule, 0, len(rules))
+	nextRule:
+		for _, rule := range rules {
+			for _, sym := range rule.Expr {
+				if ref, ok := sym.(RuleRef); ok && !defined[ref.Variable] {
+					continue nextRule
+				}
+			}
+			res = append(res, rule)
+		}
+		if len(res) == len(rules) {
+			return res
+		}
+		rules = res
+	}
+}
+
+// freshVariable returns a variable named after name that is not in used, and marks it used
+func freshVariable(used *OrderedSet[Variable], name string) Variable {
+	v := Variable(name)
+	for i := 1; used.Contains(v); i++ {
+		v = Variable(fmt.Sprintf("%s_%d", name, i))
+	}
+	used.Insert(v)
+	return v
+}
+
+func isTerminal(sym Symbol) bool {
+	_, ok := sym.(RuleRef)
+	return !ok
+}
+
+func (g *Grammar) usedVariables() OrderedSet[Variable] {
+	used := NewOrderedSet[Variable]()
+	for _, v := range g.Variables.Data {
+		used.Insert(v)
+	}
+	return used
+}
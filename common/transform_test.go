@@ -0,0 +1,62 @@
+package common
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestTransformMetadata(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		{Variable: "T", Expr: Expr{Literal("1")}, Label: "Num"},
+		{Variable: "E", Expr: Expr{Ref("E"), Literal("+"), Ref("T")}, Label: "Add", Annotations: map[string]string{"assoc": "left"}},
+		NewRule("E", Expr{Ref("T")}),
+		{Variable: "E", Expr: Expr{Literal("("), Ref("E"), Literal(")"), Ref("O")}, Label: "Paren"},
+		NewRule("O", Expr{}),
+		{Variable: "O", Expr: Expr{Literal("!")}, Label: "Bang"},
+	}, WithStart("E"), WithName("calc"))
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	tests := []struct {
+		name string
+		fn   func(g *Grammar) (*Grammar, error)
+		// start tells whether the transformation keeps the start variable
+		start bool
+	}{
+		{"ToCNF", (*Grammar).ToCNF, false},
+		{"ToGNF", (*Grammar).ToGNF, false},
+		{"RemoveLeftRecursion", (*Grammar).RemoveLeftRecursion, false},
+		{"RemoveEpsilon", (*Grammar).RemoveEpsilon, true},
+		{"RemoveUnit", (*Grammar).RemoveUnit, true},
+		{"RemoveCycles", (*Grammar).RemoveCycles, true},
+		{"RemoveUseless", (*Grammar).RemoveUseless, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := tt.fn(g)
+			if err != nil {
+				t.Fatalf("%s() unexpected error: %v", tt.name, err)
+			}
+			if h.Name != "calc" {
+				t.Errorf("%s() name %q, wanted %q", tt.name, h.Name, "calc")
+			}
+			if tt.start && h.StartVariable() != "E" {
+				t.Errorf("%s() start variable %s, wanted E", tt.name, h.StartVariable())
+			}
+			labels := make(map[string]bool)
+			for _, rule := range h.Rules {
+				if rule.Label == "" {
+					continue
+				}
+				labels[rule.Label] = true
+				if rule.Label == "Add" && rule.Annotations["assoc"] != "left" {
+					t.Errorf("%s() rule %s lost its annotations", tt.name, rule)
+				}
+			}
+			if got := slices.Sorted(maps.Keys(labels)); !slices.Equal(got, []string{"Add", "Bang", "Num", "Paren"}) {
+				t.Errorf("%s() labels %v, wanted every label of the grammar\n%s", tt.name, got, h)
+			}
+		})
+	}
+}
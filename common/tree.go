@@ -0,0 +1,158 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseTree is a node of a parse tree.
+// Inner nodes are applications of a rule to a variable, leaves are terminals
+// matched against a span of the input.
+type ParseTree struct {
+	// Rule is the index of the applied rule in Grammar.Rules, -1 for leaves
+	Rule     int
+	Variable Variable
+	// Terminal is the symbol a leaf matched
+	Terminal Symbol
+	Span     Span
+	Children []*ParseTree
+}
+
+// NewLeaf returns a leaf for a terminal matched over span
+func NewLeaf(terminal Symbol, span Span) *ParseTree {
+	return &ParseTree{
+		Rule:     -1,
+		Terminal: terminal,
+		Span:     span,
+	}
+}
+
+// ErrorRule is the Rule of the error leaves of best-effort trees, standing for
+// input skipped by error recovery (Terminal is nil) or for a symbol missing from
+// the input (Terminal is the symbol, a RuleRef for a variable)
+const ErrorRule = -2
+
+// NewErrorLeaf returns an error leaf standing for sym over span
+func NewErrorLeaf(sym Symbol, span Span) *ParseTree {
+	return &ParseTree{
+		Rule:     ErrorRule,
+		Terminal: sym,
+		Span:     span,
+	}
+}
+
+// IsLeaf returns whether the node is a terminal or an error
+func (t *ParseTree) IsLeaf() bool {
+	return t.Rule < 0
+}
+
+// IsError returns whether the node is an error leaf
+func (t *ParseTree) IsError() bool {
+	return t.Rule == ErrorRule
+}
+
+// Walk visits the tree in pre-order, children of a node are skipped if fn returns false
+func (t *ParseTree) Walk(fn func(node *ParseTree) bool) {
+	if !fn(t) {
+		return
+	}
+	for _, child := range t.Children {
+		child.Walk(fn)
+	}
+}
+
+// WalkPostOrder visits the tree in post-order
+func (t *ParseTree) WalkPostOrder(fn func(node *ParseTree)) {
+	for _, child := range t.Children {
+		child.WalkPostOrder(fn)
+	}
+	fn(t)
+}
+
+// Find returns every node deriving the variable v, in pre-order
+func (t *ParseTree) Find(v Variable) []*ParseTree {
+	var nodes []*ParseTree
+	t.Walk(func(node *ParseTree) bool {
+		if !node.IsLeaf() && node.Variable == v {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return nodes
+}
+
+// Text returns the part of the input the subtree was parsed from
+func (t *ParseTree) Text(input string) string {
+	return input[t.Span.Start:t.Span.End]
+}
+
+// LeftParse returns the rule numbers of the leftmost derivation the tree represents
+func (t *ParseTree) LeftParse() []int {
+	leftParse := make([]int, 0)
+	t.Walk(func(node *ParseTree) bool {
+		if !node.IsLeaf() {
+			leftParse = append(leftParse, node.Rule)
+		}
+		return true
+	})
+	return leftParse
+}
+
+// RecomputeSpans recomputes the spans of inner nodes from their leaves, starting
+// at the offset start. Subtrees deriving ε get an empty span where they occur.
+func (t *ParseTree) RecomputeSpans(start int) {
+	t.recomputeSpans(start)
+}
+
+func (t *ParseTree) recomputeSpans(pos int) int {
+	if t.IsLeaf() {
+		return t.Span.End
+	}
+	start, end := -1, pos
+	for _, child := range t.Children {
+		end = child.recomputeSpans(end)
+		if start < 0 && child.Span.Start != child.Span.End {
+			start = child.Span.Start
+		}
+	}
+	if start < 0 {
+		start = pos
+		end = pos
+	}
+	t.Span = Span{Start: start, End: end}
+	return end
+}
+
+func (t *ParseTree) String() string {
+	var sb strings.Builder
+	t.write(&sb, 0)
+	return sb.String()
+}
+
+func (t *ParseTree) write(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	// Terminals are quoted but for character classes
+	terminal := fmt.Sprintf("'%v'", t.Terminal)
+	if class, ok := t.Terminal.(CharClass); ok {
+		terminal = class.String()
+	}
+	switch {
+	case t.IsError() && t.Terminal == nil:
+		fmt.Fprintf(sb, "error: skipped [%d:%d]\n", t.Span.Start, t.Span.End)
+		return
+	case t.IsError():
+		if ref, ok := t.Terminal.(RuleRef); ok {
+			fmt.Fprintf(sb, "error: missing %s [%d:%d]\n", ref.Variable, t.Span.Start, t.Span.End)
+		} else {
+			fmt.Fprintf(sb, "error: missing %s [%d:%d]\n", terminal, t.Span.Start, t.Span.End)
+		}
+		return
+	case t.IsLeaf():
+		fmt.Fprintf(sb, "%s [%d:%d]\n", terminal, t.Span.Start, t.Span.End)
+		return
+	}
+	fmt.Fprintf(sb, "%s (%d) [%d:%d]\n", t.Variable, t.Rule, t.Span.Start, t.Span.End)
+	for _, child := range t.Children {
+		child.write(sb, depth+1)
+	}
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+// exampleTree is the tree of "a+b" for the rules
+// 0: S -> S '+' T, 1: S -> T, 2: T -> 'a', 3: T -> 'b'
+func exampleTree() *ParseTree {
+	return &ParseTree{Rule: 0, Variable: "S", Span: Span{0, 3}, Children: []*ParseTree{
+		{Rule: 1, Variable: "S", Span: Span{0, 1}, Children: []*ParseTree{
+			{Rule: 2, Variable: "T", Span: Span{0, 1}, Children: []*ParseTree{
+				NewLeaf(Literal("a"), Span{0, 1}),
+			}},
+		}},
+		NewLeaf(Literal("+"), Span{1, 2}),
+		{Rule: 3, Variable: "T", Span: Span{2, 3}, Children: []*ParseTree{
+			NewLeaf(Literal("b"), Span{2, 3}),
+		}},
+	}}
+}
+
+func TestParseTreeLeftParse(t *testing.T) {
+	leftParse := exampleTree().LeftParse()
+	expected := []int{0, 1, 2, 3}
+	if len(leftParse) != len(expected) {
+		t.Fatalf("LeftParse() = %v, want %v", leftParse, expected)
+	}
+	for i := range expected {
+		if leftParse[i] != expected[i] {
+			t.Fatalf("LeftParse() = %v, want %v", leftParse, expected)
+		}
+	}
+}
+
+func TestParseTreeWalk(t *testing.T) {
+	tree := exampleTree()
+
+	var pre []string
+	tree.Walk(func(node *ParseTree) bool {
+		if node.IsLeaf() {
+			pre = append(pre, node.Terminal.String())
+			return true
+		}
+		pre = append(pre, node.Variable.String())
+		// Skip the children of the right operand
+		return node.Span.Start != 2
+	})
+	if got := strings.Join(pre, " "); got != "S S T a + T" {
+		t.Errorf("Walk() visited %v", got)
+	}
+
+	var post []string
+	tree.WalkPostOrder(func(node *ParseTree) {
+		if node.IsLeaf() {
+			post = append(post, node.Terminal.String())
+		} else {
+			post = append(post, node.Variable.String())
+		}
+	})
+	if got := strings.Join(post, " "); got != "a T S + b T S" {
+		t.Errorf("WalkPostOrder() visited %v", got)
+	}
+}
+
+func TestParseTreeFind(t *testing.T) {
+	input := "a+b"
+	tree := exampleTree()
+
+	tests := []struct {
+		variable Variable
+		expected []string
+	}{
+		{"S", []string{"a+b", "a"}},
+		{"T", []string{"a", "b"}},
+		{"U", []string{}},
+	}
+	for _, tt := range tests {
+		nodes := tree.Find(tt.variable)
+		if len(nodes) != len(tt.expected) {
+			t.Errorf("Find(%s) found %d nodes, want %d", tt.variable, len(nodes), len(tt.expected))
+			continue
+		}
+		for i, node := range nodes {
+			if node.Text(input) != tt.expected[i] {
+				t.Errorf("Find(%s)[%d].Text() = %v, want %v", tt.variable, i, node.Text(input), tt.expected[i])
+			}
+		}
+	}
+}
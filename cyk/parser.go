@@ -0,0 +1,211 @@
+package cyk
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+// binaryRule is a rule A -> B C of the CNF grammar
+type binaryRule struct {
+	rule  int
+	left  Variable
+	right Variable
+}
+
+// cell records for every variable deriving a span of the input the rule and
+// pivot of one of its derivations
+type cell map[Variable]split
+
+type split struct {
+	rule  int
+	pivot int
+}
+
+type realParser struct {
+	gram *Grammar
+	cnf  *Grammar
+	// binary holds the rules A -> B C of the CNF grammar by A
+	binary []binaryRule
+	// unary holds the indices of the rules A -> a of the CNF grammar
+	unary []int
+	// empty is the index of the rule S0 -> ε, -1 if there is none
+	empty int
+}
+
+// table is the state of a single parse, so that a parser can run any number
+// of parses at once. T[i][j] holds the variables deriving the input from i to j.
+type table struct {
+	*realParser
+	T [][]cell
+	// match reports whether a terminal symbol spans the input from i to j
+	match func(i, j int, sym Symbol) bool
+	// span maps the input positions [i, j) to a Span of the source
+	span func(i, j int) Span
+}
+
+func (p *realParser) Parse(input string) ([]int, error) {
+	tree, err := p.ParseTree(input)
+	if err != nil {
+		return nil, err
+	}
+	return tree.LeftParse(), nil
+}
+
+func (p *realParser) ParseTokens(tokens []Token) ([]int, error) {
+	tree, err := p.ParseTokensTree(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return tree.LeftParse(), nil
+}
+
+func (p *realParser) ParseTree(input string) (*ParseTree, error) {
+	t := &table{realParser: p}
+	t.match = func(i, j int, sym Symbol) bool {
+		switch v := sym.(type) {
+		case Literal:
+			return input[i:j] == v.String()
+		case Terminal:
+			return input[i:j] == v.String()
+		case CharClass:
+			r, size := utf8.DecodeRuneInString(input[i:j])
+			return size == j-i && v.Match(r)
+		}
+		return false
+	}
+	t.span = func(i, j int) Span {
+		return Span{Start: i, End: j}
+	}
+	return t.parse(len(input))
+}
+
+func (p *realParser) ParseTokensTree(tokens []Token) (*ParseTree, error) {
+	t := &table{realParser: p}
+	t.match = func(i, j int, sym Symbol) bool {
+		if j != i+1 {
+			return false
+		}
+		switch v := sym.(type) {
+		case Literal:
+			return tokens[i].Kind == Terminal(v)
+		case Terminal:
+			return tokens[i].Kind == v
+		case CharClass:
+			// A class matches the tokens whose kind is one of its characters
+			r, size := utf8.DecodeRuneInString(tokens[i].Kind.String())
+			return size > 0 && size == len(tokens[i].Kind) && v.Match(r)
+		}
+		return false
+	}
+	t.span = func(i, j int) Span {
+		if len(tokens) == 0 {
+			return Span{}
+		}
+		return Span{Start: tokens[i].Span.Start, End: tokens[j-1].Span.End}
+	}
+	return t.parse(len(tokens))
+}
+
+// parse fills the CYK table T over an input of length n
+func (t *table) parse(n int) (*ParseTree, error) {
+	start := t.cnf.StartVariable()
+	if n == 0 {
+		if t.empty < 0 {
+			return nil, errors.New("Input is not in the language")
+		}
+		return t.cnf.FoldTo(&ParseTree{Rule: t.empty, Variable: start}, t.gram)
+	}
+
+	t.T = make([][]cell, n+1)
+	for i := range t.T {
+		t.T[i] = make([]cell, n+1)
+		for j := range t.T[i] {
+			t.T[i][j] = make(cell)
+		}
+	}
+
+	for length := 1; length <= n; length++ {
+		for i := 0; i+length <= n; i++ {
+			j := i + length
+			for _, rule := range t.unary {
+				r := t.cnf.Rules[rule]
+				if _, ok := t.T[i][j][r.Variable]; !ok && t.match(i, j, r.Expr[0]) {
+					t.T[i][j][r.Variable] = split{rule: rule, pivot: j}
+				}
+			}
+			for k := i + 1; k < j; k++ {
+				for _, b := range t.binary {
+					if _, ok := t.T[i][j][t.cnf.Rules[b.rule].Variable]; ok {
+						continue
+					}
+					if _, ok := t.T[i][k][b.left]; !ok {
+						continue
+					}
+					if _, ok := t.T[k][j][b.right]; !ok {
+						continue
+					}
+					t.T[i][j][t.cnf.Rules[b.rule].Variable] = split{rule: b.rule, pivot: k}
+				}
+			}
+		}
+	}
+
+	if _, ok := t.T[0][n][start]; !ok {
+		return nil, errors.New("Input is not in the language")
+	}
+	return t.cnf.FoldTo(t.tree(start, 0, n), t.gram)
+}
+
+// tree builds the parse tree of the CNF grammar recorded in the table for v over [i, j)
+func (t *table) tree(v Variable, i, j int) *ParseTree {
+	s := t.T[i][j][v]
+	node := &ParseTree{
+		Rule:     s.rule,
+		Variable: v,
+		Span:     t.span(i, j),
+	}
+	expr := t.cnf.Rules[s.rule].Expr
+	if len(expr) == 1 {
+		node.Children = []*ParseTree{NewLeaf(expr[0], t.span(i, j))}
+		return node
+	}
+	node.Children = []*ParseTree{
+		t.tree(expr[0].(RuleRef).Variable, i, s.pivot),
+		t.tree(expr[1].(RuleRef).Variable, s.pivot, j),
+	}
+	return node
+}
+
+// New creates a CYK parser for gram, working on its Chomsky Normal Form.
+// Derivations are folded back so rule numbers refer to gram.
+func New(gram *Grammar) (TreeParser, error) {
+	cnf, err := gram.ToCNF()
+	if err != nil {
+		return nil, err
+	}
+	p := &realParser{
+		gram:  gram,
+		cnf:   cnf,
+		empty: -1,
+	}
+	for i, rule := range cnf.Rules {
+		switch len(rule.Expr) {
+		case 0:
+			p.empty = i
+		case 1:
+			p.unary = append(p.unary, i)
+		case 2:
+			p.binary = append(p.binary, binaryRule{
+				rule:  i,
+				left:  rule.Expr[0].(RuleRef).Variable,
+				right: rule.Expr[1].(RuleRef).Variable,
+			})
+		default:
+			return nil, errors.New("Grammar is not in Chomsky Normal Form: " + strings.TrimSpace(rule.String()))
+		}
+	}
+	return p, nil
+}
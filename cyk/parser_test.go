@@ -0,0 +1,135 @@
+package cyk
+
+import (
+	"slices"
+	"testing"
+
+	. "github.com/costowell/parsing-fun/common"
+	"github.com/costowell/parsing-fun/earley"
+	"github.com/costowell/parsing-fun/internal/parsertest"
+)
+
+func TestSuite(t *testing.T) {
+	parsertest.Run(t, func(g *Grammar) (Parser, error) {
+		return New(g)
+	})
+}
+
+func TestConcurrent(t *testing.T) {
+	parsertest.RunConcurrent(t, func(g *Grammar) (Parser, error) {
+		return New(g)
+	})
+}
+
+func TestSameLeftParseAsEarley(t *testing.T) {
+	for _, tc := range parsertest.Cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			g, err := NewGrammar(tc.Rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			parser, err := New(g)
+			if err != nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+			reference := earley.New(g)
+			for _, input := range tc.Accept {
+				forest, err := reference.ParseForest(input)
+				if err != nil {
+					t.Fatalf("ParseForest(%q) unexpected error: %v", input, err)
+				}
+				if forest.IsAmbiguous() {
+					continue
+				}
+				expected := forest.Tree().LeftParse()
+				leftParse, err := parser.Parse(input)
+				if err != nil {
+					t.Errorf("Parse(%q) unexpected error: %v", input, err)
+					continue
+				}
+				if !slices.Equal(leftParse, expected) {
+					t.Errorf("Parse(%q) = %v, earley parsed %v", input, leftParse, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTokensTree(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("E", Expr{Ref("E"), Literal("+"), Ref("T")}),
+		NewRule("E", Expr{Ref("T")}),
+		NewRule("T", Expr{Terminal("NUM")}),
+		NewRule("T", Expr{Literal("("), Ref("E"), Literal(")")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	lexer, err := NewRegexLexer([]TokenDef{
+		{Kind: "WS", Pattern: `\s+`, Skip: true},
+		{Kind: "NUM", Pattern: `[0-9]+`},
+		{Kind: "+", Pattern: `\+`},
+		{Kind: "(", Pattern: `\(`},
+		{Kind: ")", Pattern: `\)`},
+	})
+	if err != nil {
+		t.Fatalf("NewRegexLexer() unexpected error: %v", err)
+	}
+	parser, err := New(g)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	input := "12 + (3 + 456)"
+	tokens, err := lexer.Tokenize(input)
+	if err != nil {
+		t.Fatalf("Tokenize() unexpected error: %v", err)
+	}
+	tree, err := parser.ParseTokensTree(tokens)
+	if err != nil {
+		t.Fatalf("ParseTokensTree() unexpected error: %v", err)
+	}
+	if expected := []int{0, 1, 2, 3, 0, 1, 2, 2}; !slices.Equal(tree.LeftParse(), expected) {
+		t.Errorf("ParseTokensTree() left parse = %v, want %v", tree.LeftParse(), expected)
+	}
+	var terms []string
+	for _, node := range tree.Find("T") {
+		terms = append(terms, node.Text(input))
+	}
+	if expected := []string{"12", "(3 + 456)", "3", "456"}; !slices.Equal(terms, expected) {
+		t.Errorf("Find(T) = %q, want %q", terms, expected)
+	}
+}
+
+func TestCharClasses(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("List", Expr{Ref("List"), Literal(","), Ref("Item")}),
+		NewRule("List", Expr{Ref("Item")}),
+		NewRule("Item", Expr{CharClass(`\p{L}`), Ref("Rest")}),
+		NewRule("Item", Expr{CharClass(`\p{L}`)}),
+		NewRule("Rest", Expr{CharClass(`[\p{L}0-9]`), Ref("Rest")}),
+		NewRule("Rest", Expr{CharClass(`[\p{L}0-9]`)}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	parser, err := New(g)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	reference := earley.New(g)
+	for _, input := range []string{"x", "été,a1", "λ,b2c,d"} {
+		expected, err := reference.Parse(input)
+		if err != nil {
+			t.Fatalf("Parse(%q) earley unexpected error: %v", input, err)
+		}
+		if leftParse, err := parser.Parse(input); err != nil || !slices.Equal(leftParse, expected) {
+			t.Errorf("Parse(%q) = %v, %v, earley parsed %v", input, leftParse, err, expected)
+		}
+	}
+	for _, input := range []string{"1", "a,", "a b"} {
+		if _, err := parser.Parse(input); err == nil {
+			t.Errorf("Parse(%q) expected error, got none", input)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package earley
+
+import (
+	. "github.com/costowell/parsing-fun/common"
+)
+
+// chart is the state of a single parse, the Earley sets over an input of length
+// n, so that a parser can run any number of parses at once
+type chart struct {
+	*realParser
+	n int
+	// S holds a set for every position of the input
+	S []set
+	// last is the furthest set holding states
+	last int
+	// match returns the number of positions a terminal symbol spans when it
+	// matches the input at position k, -1 if it does not
+	match func(k int, sym Symbol) int
+	// before returns the position a terminal symbol ending at position j would
+	// start from, character classes spanning characters of any width
+	before func(j int, sym Symbol) int
+	// span maps the input positions [i, j) to a Span of the source
+	span func(i, j int) Span
+	// skip returns the position after the character or token at position k
+	skip func(k int) int
+	// unexpected returns the error of expecting one of the expected terminals at position k
+	unexpected func(k int, expected []Terminal) *ParseError
+	// transitive memoises the transitive items of each set by variable ID
+	transitive []map[int]*transitiveItem
+	// reduced holds for each set the transitive items whose paths were
+	// completed at once, skipping the completed items along them
+	reduced [][]*transitiveItem
+}
+
+func (p *realParser) newChart(n int) *chart {
+	return &chart{
+		realParser: p,
+		n:          n,
+		S:          make([]set, n+1),
+		transitive: make([]map[int]*transitiveItem, n+1),
+		reduced:    make([][]*transitiveItem, n+1),
+	}
+}
+
+// set is an Earley set, its states indexed by the symbol they expect
+type set struct {
+	states []State
+	seen   map[State]struct{}
+	// waiting holds the states expecting each variable by ID
+	waiting map[int][]State
+	// scanning holds the states expecting each terminal, terminals holding
+	// the symbol of their first state in the order they were added
+	scanning  map[Terminal][]State
+	terminals []Symbol
+}
+
+func (s *set) contains(state State) bool {
+	_, ok := s.seen[state]
+	return ok
+}
+
+// compile numbers the variables and dotted rules of the grammar, _P -> •S last
+func (p *realParser) compile() {
+	p.variables = make(map[Variable]int, len(p.gram.Variables.Data))
+	for id, v := range p.gram.Variables.Data {
+		p.variables[v] = id
+	}
+	p.nullable = make([]bool, len(p.variables))
+	for v := range p.gram.FirstFollow().Nullable {
+		p.nullable[p.variables[v]] = true
+	}
+
+	add := func(rule int, variable Variable, expr Expr) int {
+		first := len(p.items)
+		lhs, ok := p.variables[variable]
+		if !ok {
+			lhs = -1
+		}
+		for dot := 0; dot <= len(expr); dot++ {
+			item := dottedRule{rule: rule, dot: dot, variable: variable, lhs: lhs, expr: expr, waitsFor: -1}
+			if dot < len(expr) {
+				item.next = expr[dot]
+				if ref, ok := expr[dot].(RuleRef); ok {
+					item.waitsFor = p.variables[ref.Variable]
+				}
+			}
+			p.items = append(p.items, item)
+		}
+		return first
+	}
+	p.predictions = make([][]int, len(p.variables))
+	p.ruleItems = make([]int, len(p.gram.Rules))
+	for i, rule := range p.gram.Rules {
+		p.ruleItems[i] = add(i, rule.Variable, rule.Expr)
+		lhs := p.variables[rule.Variable]
+		p.predictions[lhs] = append(p.predictions[lhs], p.ruleItems[i])
+	}
+	p.start = add(-1, "_P", Expr{Ref(p.gram.StartVariable())})
+}
+
+// insert adds a state to set k unless it holds it already, reporting whether it did
+func (c *chart) insert(k int, state State) bool {
+	s := &c.S[k]
+	if s.seen == nil {
+		// A set predicts every rule at most once, which bounds most of them
+		size := len(c.gram.Rules)
+		s.states = make([]State, 0, size)
+		s.seen = make(map[State]struct{}, size)
+		s.waiting = make(map[int][]State)
+		s.scanning = make(map[Terminal][]State)
+	}
+	if _, ok := s.seen[state]; ok {
+		return false
+	}
+	s.seen[state] = struct{}{}
+	s.states = append(s.states, state)
+	c.last = max(c.last, k)
+
+	item := &c.items[state.item]
+	switch {
+	case item.waitsFor >= 0:
+		s.waiting[item.waitsFor] = append(s.waiting[item.waitsFor], state)
+	case item.next != nil:
+		t, _ := TerminalOf(item.next)
+		if _, ok := s.scanning[t]; !ok {
+			s.terminals = append(s.terminals, item.next)
+		}
+		s.scanning[t] = append(s.scanning[t], state)
+	}
+	return true
+}
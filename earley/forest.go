@@ -0,0 +1,220 @@
+package earley
+
+import (
+	"cmp"
+	"slices"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+type nodeKey struct {
+	// variable is the ID of the variable of a symbol node
+	variable int
+	terminal Symbol
+	rule     int
+	dot      int
+	i        int
+	j        int
+}
+
+type originsKey struct {
+	variable Variable
+	k        int
+}
+
+// forestBuilder reconstructs the derivations of a successful parse from the chart
+type forestBuilder struct {
+	c *chart
+	// completed holds the completed states of the sets used so far by variable
+	completed map[int]map[Variable][]State
+	// origins holds the origins of the completed states of a variable in a set
+	origins map[originsKey][]int
+	// ends holds the sets of every incomplete state in ascending order
+	ends  map[State][]int
+	nodes map[nodeKey]*ForestNode
+}
+
+// BuildForest builds the binarised SPPF of the start variable over the whole input.
+// Nodes are created top-down from the root, each split of a rule at a pivot k is
+// kept only if the chart holds the state deriving the prefix up to k.
+func (c *chart) BuildForest() *Forest {
+	size := 0
+	for _, set := range c.S {
+		size += len(set.states)
+	}
+	b := &forestBuilder{
+		c:         c,
+		completed: make(map[int]map[Variable][]State),
+		origins:   make(map[originsKey][]int),
+		ends:      make(map[State][]int, size),
+		nodes:     make(map[nodeKey]*ForestNode),
+	}
+	for k, set := range c.S {
+		for _, state := range set.states {
+			if c.items[state.item].next != nil {
+				b.ends[state] = append(b.ends[state], k)
+			}
+		}
+	}
+	return &Forest{Root: b.symbolNode(c.gram.StartVariable(), 0, len(c.S)-1)}
+}
+
+// completedAt returns the completed states of set k by variable, those skipped
+// along Leo's reduction paths included, ordered by origin and rule so the forest
+// does not depend on the order of the chart
+func (b *forestBuilder) completedAt(k int) map[Variable][]State {
+	if completed, ok := b.completed[k]; ok {
+		return completed
+	}
+	states := NewOrderedSet[State]()
+	for _, state := range b.c.S[k].states {
+		if b.c.items[state.item].next == nil {
+			states.Insert(state)
+		}
+	}
+	// Paths merge, each transitive item is followed once
+	seen := make(map[*transitiveItem]bool)
+	for _, t := range b.c.reduced[k] {
+		for ; t != nil && !seen[t]; t = t.next {
+			seen[t] = true
+			states.Insert(t.completed)
+		}
+	}
+
+	completed := make(map[Variable][]State)
+	for _, state := range states.Data {
+		v := b.c.items[state.item].variable
+		completed[v] = append(completed[v], state)
+	}
+	for _, list := range completed {
+		slices.SortStableFunc(list, func(x, y State) int {
+			return cmp.Or(cmp.Compare(x.origin, y.origin), cmp.Compare(b.c.items[x.item].rule, b.c.items[y.item].rule))
+		})
+	}
+	b.completed[k] = completed
+	return completed
+}
+
+// originsAt returns the origins of the completed states of v in set k in ascending order
+func (b *forestBuilder) originsAt(k int, v Variable) []int {
+	key := originsKey{variable: v, k: k}
+	if origins, ok := b.origins[key]; ok {
+		return origins
+	}
+	var origins []int
+	for _, state := range b.completedAt(k)[v] {
+		if len(origins) == 0 || origins[len(origins)-1] != state.origin {
+			origins = append(origins, state.origin)
+		}
+	}
+	b.origins[key] = origins
+	return origins
+}
+
+func (b *forestBuilder) symbolNode(v Variable, i, j int) *ForestNode {
+	key := nodeKey{variable: b.c.variables[v], rule: -1, i: i, j: j}
+	if node, ok := b.nodes[key]; ok {
+		return node
+	}
+	node := &ForestNode{
+		Variable: v,
+		Rule:     -1,
+		Span:     b.c.span(i, j),
+	}
+	b.nodes[key] = node
+	for _, state := range b.completedAt(j)[v] {
+		if state.origin != i {
+			continue
+		}
+		item := &b.c.items[state.item]
+		node.Packed = append(node.Packed, b.packed(item.rule, item.dot, i, j)...)
+	}
+	return node
+}
+
+func (b *forestBuilder) terminalNode(sym Symbol, i, j int) *ForestNode {
+	key := nodeKey{terminal: sym, rule: -1, i: i, j: j}
+	if node, ok := b.nodes[key]; ok {
+		return node
+	}
+	node := &ForestNode{
+		Terminal: sym,
+		Rule:     -1,
+		Span:     b.c.span(i, j),
+	}
+	b.nodes[key] = node
+	return node
+}
+
+func (b *forestBuilder) intermediateNode(rule, dot, i, j int) *ForestNode {
+	key := nodeKey{rule: rule, dot: dot, i: i, j: j}
+	if node, ok := b.nodes[key]; ok {
+		return node
+	}
+	node := &ForestNode{
+		Variable: b.c.gram.Rules[rule].Variable,
+		Rule:     rule,
+		Dot:      dot,
+		Span:     b.c.span(i, j),
+	}
+	b.nodes[key] = node
+	node.Packed = b.packed(rule, dot, i, j)
+	return node
+}
+
+// packed returns every way the first dot symbols of a rule derive the input from i to j
+func (b *forestBuilder) packed(rule, dot, i, j int) []*PackedNode {
+	if dot == 0 {
+		return []*PackedNode{{Rule: rule}}
+	}
+
+	r := b.c.gram.Rules[rule]
+	// prefix returns the node deriving the symbols before the last one up to k,
+	// or false if the chart holds no such derivation
+	prefix := func(k int) (*ForestNode, bool) {
+		if k < i {
+			return nil, false
+		}
+		if dot == 1 {
+			return nil, k == i
+		}
+		if !b.c.S[k].contains(State{item: b.c.ruleItems[rule] + dot - 1, origin: i}) {
+			return nil, false
+		}
+		return b.intermediateNode(rule, dot-1, i, k), true
+	}
+
+	var packed []*PackedNode
+	switch v := r.Expr[dot-1].(type) {
+	case RuleRef:
+		// Pivots are the sets where the prefix ends and v starts, taken from
+		// the origins of v or the ends of the prefix, whichever are fewer
+		origins := b.originsAt(j, v.Variable)
+		pivots := origins
+		if ends := b.ends[State{item: b.c.ruleItems[rule] + dot - 1, origin: i}]; dot > 1 && len(ends) < len(pivots) {
+			pivots = ends
+		}
+		for _, k := range pivots {
+			if _, ok := slices.BinarySearch(origins, k); !ok {
+				continue
+			}
+			if left, ok := prefix(k); ok {
+				packed = append(packed, &PackedNode{
+					Rule:  rule,
+					Left:  left,
+					Right: b.symbolNode(v.Variable, k, j),
+				})
+			}
+		}
+	default:
+		k := b.c.before(j, v)
+		if left, ok := prefix(k); ok && b.c.match(k, v) == j-k {
+			packed = append(packed, &PackedNode{
+				Rule:  rule,
+				Left:  left,
+				Right: b.terminalNode(v, k, j),
+			})
+		}
+	}
+	return packed
+}
@@ -0,0 +1,173 @@
+package earley
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+func TestParseForest(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       []Rule
+		input       string
+		count       int64
+		infinite    bool
+		ambiguous   bool
+		expectError bool
+	}{
+		{
+			name: "unambiguous",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("S"), Literal("+"), Literal("1")}),
+				NewRule("S", Expr{Literal("1")}),
+			},
+			input:     "1+1+1",
+			count:     1,
+			ambiguous: false,
+		},
+		{
+			name: "catalan",
+			rules: []Rule{
+				NewRule("E", Expr{Ref("E"), Literal("+"), Ref("E")}),
+				NewRule("E", Expr{Literal("1")}),
+			},
+			input:     "1+1+1+1",
+			count:     5,
+			ambiguous: true,
+		},
+		{
+			name: "palindrome",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Ref("S"), Literal("a")}),
+				NewRule("S", Expr{Literal("b"), Ref("S"), Literal("b")}),
+				NewRule("S", Expr{Ref("A"), Ref("A")}),
+				NewRule("S", Expr{Literal("a")}),
+				NewRule("S", Expr{Literal("b")}),
+				NewRule("A", Expr{Literal("a")}),
+			},
+			input:     "abaaba",
+			count:     1,
+			ambiguous: false,
+		},
+		{
+			name: "shared ambiguity",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A"), Ref("A")}),
+				NewRule("A", Expr{Literal("a")}),
+				NewRule("A", Expr{Literal("a"), Literal("a")}),
+			},
+			input:     "aaa",
+			count:     2,
+			ambiguous: true,
+		},
+		{
+			name: "cycle",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A")}),
+				NewRule("S", Expr{Literal("a")}),
+				NewRule("A", Expr{Ref("S")}),
+			},
+			input:     "a",
+			count:     1,
+			infinite:  true,
+			ambiguous: true,
+		},
+		{
+			name: "rejected",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a")}),
+			},
+			input:       "aa",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			forest, err := New(g).ParseForest(tt.input)
+			if tt.expectError && err == nil {
+				t.Errorf("ParseForest() expected error, got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("ParseForest() unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+
+			if forest.IsAmbiguous() != tt.ambiguous {
+				t.Errorf("IsAmbiguous() = %v, want %v", forest.IsAmbiguous(), tt.ambiguous)
+			}
+
+			count, err := forest.Count()
+			if tt.infinite && err != ErrInfiniteDerivations {
+				t.Errorf("Count() = %v, %v, want ErrInfiniteDerivations", count, err)
+			}
+			if !tt.infinite && (err != nil || count.Int64() != tt.count) {
+				t.Errorf("Count() = %v, %v, want %v", count, err, tt.count)
+			}
+
+			// Every enumerated derivation is distinct and derives the input
+			seen := make(map[string]bool)
+			for tree := range forest.Trees() {
+				leftParse := tree.LeftParse()
+				str, err := g.EvalLeftParse(leftParse)
+				if err != nil || str != tt.input {
+					t.Errorf("EvalLeftParse(%v) = %v, %v, want %v", leftParse, str, err, tt.input)
+				}
+				key := fmt.Sprint(leftParse)
+				if seen[key] {
+					t.Errorf("Trees() enumerated %v twice", leftParse)
+				}
+				seen[key] = true
+			}
+			if int64(len(seen)) != tt.count {
+				t.Errorf("Trees() enumerated %d derivations, want %d", len(seen), tt.count)
+			}
+
+			tree := forest.Tree()
+			if str, err := g.EvalLeftParse(tree.LeftParse()); err != nil || str != tt.input {
+				t.Errorf("Tree() derives %v, %v, want %v", str, err, tt.input)
+			}
+		})
+	}
+}
+
+func TestForestTreesLazy(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("E", Expr{Ref("E"), Literal("+"), Ref("E")}),
+		NewRule("E", Expr{Literal("1")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	// 1+1+...+1 with 16 operands has Catalan(15) = 9694845 derivations
+	input := "1"
+	for range 15 {
+		input += "+1"
+	}
+	forest, err := New(g).ParseForest(input)
+	if err != nil {
+		t.Fatalf("ParseForest() unexpected error: %v", err)
+	}
+	count, err := forest.Count()
+	if err != nil || count.Int64() != 9694845 {
+		t.Errorf("Count() = %v, %v, want 9694845", count, err)
+	}
+	n := 0
+	for range forest.Trees() {
+		n++
+		if n == 10 {
+			break
+		}
+	}
+	if n != 10 {
+		t.Errorf("Trees() stopped after %d derivations", n)
+	}
+}
@@ -0,0 +1,150 @@
+package earley
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/costowell/parsing-fun/common"
+	"github.com/costowell/parsing-fun/internal/parsertest"
+)
+
+// chartSize returns the number of states of a chart
+func chartSize(c *chart) int {
+	size := 0
+	for _, set := range c.S {
+		size += len(set.states)
+	}
+	return size
+}
+
+// derivations returns the first derivations of a forest, its chosen tree first
+func derivations(forest *Forest, n int) []string {
+	res := []string{forest.Tree().String()}
+	for tree := range forest.Trees() {
+		if len(res) > n {
+			break
+		}
+		res = append(res, tree.String())
+	}
+	return res
+}
+
+func TestLeo(t *testing.T) {
+	type input struct {
+		rules  []Rule
+		inputs []string
+	}
+	tests := map[string]input{
+		"right recursion": {
+			rules: []Rule{
+				NewRule("A", Expr{Literal("a"), Ref("A")}),
+				NewRule("A", Expr{Literal("a")}),
+			},
+			inputs: []string{"a", "aaaaaaaa"},
+		},
+		"mutual right recursion": {
+			rules: []Rule{
+				NewRule("S", Expr{Literal("x"), Ref("A")}),
+				NewRule("A", Expr{Literal("a"), Ref("B")}),
+				NewRule("A", Expr{Literal("a")}),
+				NewRule("B", Expr{Literal("b"), Ref("S")}),
+				NewRule("B", Expr{Ref("A")}),
+			},
+			inputs: []string{"xa", "xabxaa", "xaaabxabxa"},
+		},
+		"ambiguous right recursion": {
+			rules: []Rule{
+				NewRule("E", Expr{Literal("1"), Literal("+"), Ref("E")}),
+				NewRule("E", Expr{Ref("E"), Literal("+"), Ref("E")}),
+				NewRule("E", Expr{Ref("F")}),
+				NewRule("F", Expr{Literal("1")}),
+				NewRule("F", Expr{Literal("1"), Ref("F")}),
+			},
+			inputs: []string{"1+1", "1+11+1+111"},
+		},
+		"unit cycle": {
+			rules: []Rule{
+				NewRule("S", Expr{Ref("T")}),
+				NewRule("T", Expr{Ref("S")}),
+				NewRule("T", Expr{Literal("a"), Ref("S")}),
+				NewRule("T", Expr{Literal("a")}),
+			},
+			inputs: []string{"a", "aaa"},
+		},
+	}
+	for _, c := range parsertest.Cases {
+		tests[c.Name] = input{rules: c.Rules, inputs: c.Accept}
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			leo := New(g).(*realParser)
+			earley := New(g).(*realParser)
+			earley.leo = false
+			for _, input := range tt.inputs {
+				forest, err := leo.ParseForest(input)
+				if err != nil {
+					t.Fatalf("ParseForest(%q) unexpected error: %v", input, err)
+				}
+				want, err := earley.ParseForest(input)
+				if err != nil {
+					t.Fatalf("ParseForest(%q) without Leo unexpected error: %v", input, err)
+				}
+				got, expected := derivations(forest, 20), derivations(want, 20)
+				if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+					t.Errorf("ParseForest(%q) derivations differ from those without Leo\n%s\nwant\n%s", input, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestLeoLinearChart(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("A", Expr{Literal("a"), Ref("A")}),
+		NewRule("A", Expr{Literal("a")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	p := New(g).(*realParser)
+	for _, n := range []int{100, 200, 400} {
+		c := p.inputChart(strings.Repeat("a", n))
+		if _, err := c.parse(); err != nil {
+			t.Fatalf("parse() unexpected error: %v", err)
+		}
+		// _P -> •A, A -> •a A, A -> •a in the first set, then 5 states a set
+		if size := chartSize(c); size != 5*n+3 {
+			t.Errorf("chart of a^%d holds %d states, want %d", n, size, 5*n+3)
+		}
+	}
+}
+
+func BenchmarkRightRecursion(b *testing.B) {
+	g, err := NewGrammar([]Rule{
+		NewRule("A", Expr{Literal("a"), Ref("A")}),
+		NewRule("A", Expr{Literal("a")}),
+	})
+	if err != nil {
+		b.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	for _, n := range []int{100, 300, 1000} {
+		input := strings.Repeat("a", n)
+		for _, leo := range []bool{true, false} {
+			b.Run(fmt.Sprintf("n=%d/leo=%t", n, leo), func(b *testing.B) {
+				p := New(g).(*realParser)
+				p.leo = leo
+				for b.Loop() {
+					if _, err := p.ParseTree(input); err != nil {
+						b.Fatalf("ParseTree() unexpected error: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
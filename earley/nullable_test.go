@@ -0,0 +1,130 @@
+package earley
+
+import (
+	"testing"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+// TestNullable runs grammars whose nullable variables are completed in the set
+// they are predicted in, before or after the items waiting for them
+func TestNullable(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []Rule
+		accept []string
+		reject []string
+	}{
+		{
+			name: "palindromes",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Ref("S"), Literal("a")}),
+				NewRule("S", Expr{Literal("b"), Ref("S"), Literal("b")}),
+				NewRule("S", Expr{}),
+				NewRule("S", Expr{Literal("a")}),
+				NewRule("S", Expr{Literal("b")}),
+			},
+			accept: []string{"", "a", "aa", "abba", "ababa", "bbabb"},
+			reject: []string{"ab", "aab", "abab"},
+		},
+		{
+			name: "nullable twice in a row",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A"), Ref("A"), Literal("x")}),
+				NewRule("A", Expr{}),
+			},
+			accept: []string{"x"},
+			reject: []string{"", "xx"},
+		},
+		{
+			name: "nullable completed before its prediction",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A"), Ref("B")}),
+				NewRule("A", Expr{}),
+				NewRule("B", Expr{Ref("A"), Literal("b")}),
+			},
+			accept: []string{"b"},
+			reject: []string{"", "bb"},
+		},
+		{
+			name: "chain of nullable variables",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A"), Literal("s")}),
+				NewRule("A", Expr{Ref("B")}),
+				NewRule("B", Expr{Ref("C")}),
+				NewRule("C", Expr{}),
+				NewRule("C", Expr{Literal("c")}),
+			},
+			accept: []string{"s", "cs"},
+			reject: []string{"", "c", "ccs"},
+		},
+		{
+			name: "hidden left recursion",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("A"), Ref("S"), Literal("b")}),
+				NewRule("S", Expr{Literal("b")}),
+				NewRule("A", Expr{}),
+			},
+			accept: []string{"b", "bb", "bbbb"},
+			reject: []string{"", "a"},
+		},
+		{
+			name: "nullable through several rules",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("X"), Ref("Y"), Ref("Z")}),
+				NewRule("X", Expr{Ref("Y"), Ref("Z")}),
+				NewRule("Y", Expr{Ref("Z")}),
+				NewRule("Y", Expr{Literal("y")}),
+				NewRule("Z", Expr{}),
+				NewRule("Z", Expr{Literal("z")}),
+			},
+			accept: []string{"", "y", "z", "yz", "zy", "yy", "zzz", "yzyz"},
+			reject: []string{"zzzzz", "yyy"},
+		},
+		{
+			name: "infinitely ambiguous",
+			rules: []Rule{
+				NewRule("E", Expr{Ref("E"), Ref("E")}),
+				NewRule("E", Expr{Literal("a")}),
+				NewRule("E", Expr{}),
+			},
+			accept: []string{"", "a", "aaa"},
+			reject: []string{"b"},
+		},
+		{
+			name: "nullable start of a later set",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Ref("A"), Ref("A"), Ref("A"), Literal("b")}),
+				NewRule("A", Expr{Ref("B"), Ref("B")}),
+				NewRule("B", Expr{}),
+				NewRule("B", Expr{Literal("c")}),
+			},
+			accept: []string{"ab", "acb", "acccb", "accccccb"},
+			reject: []string{"a", "acccccccb"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			p := New(g)
+			for _, input := range tt.accept {
+				leftParse, err := p.Parse(input)
+				if err != nil {
+					t.Errorf("Parse(%q) unexpected error: %v", input, err)
+					continue
+				}
+				if derived, err := g.EvalLeftParse(leftParse); err != nil || derived != input {
+					t.Errorf("Parse(%q) left parse %v derives %q, %v", input, leftParse, derived, err)
+				}
+			}
+			for _, input := range tt.reject {
+				if _, err := p.Parse(input); err == nil {
+					t.Errorf("Parse(%q) expected error", input)
+				}
+			}
+		})
+	}
+}
@@ -1,187 +1,367 @@
 package earley
 
 import (
-	"errors"
-	"fmt"
+	"slices"
 	"strings"
+	"unicode/utf8"
 
 	. "github.com/costowell/parsing-fun/common"
 )
 
 type realParser struct {
-	gram      *Grammar
-	S         []OrderedSet[State]
-	BT        map[State][]*State
-	ruleOrder map[*Expr]*int
+	gram *Grammar
+	// items holds the dotted rules of the grammar by ID, start being _P -> •S
+	items []dottedRule
+	start int
+	// ruleItems holds the ID of the first dotted rule of each rule
+	ruleItems []int
+	// variables numbers the variables, predictions holding the first dotted
+	// rules of each one and nullable whether it derives ε
+	variables   map[Variable]int
+	predictions [][]int
+	nullable    []bool
+	// sync holds the synchronisation terminals of error recovery
+	sync map[Terminal]bool
+	// tracer receives the predictions, scans and completions of every parse
+	tracer Tracer
+	// leo tells whether completions follow Leo's deterministic reduction paths,
+	// it is only turned off to compare against
+	leo bool
 }
 
-func (p *realParser) InsertBT(state State, completedBy *State) {
-	if _, ok := p.BT[state]; !ok {
-		p.BT[state] = make([]*State, 0)
+// transitiveItem is Leo's transitive item of a set i for a variable C. The set
+// holds a single item expecting C, X -> β•C, so whenever C is completed from i,
+// X -> βC• is completed too and so on up the path to top.
+type transitiveItem struct {
+	top State
+	// completed is X -> βC•, next the transitive item of its origin for X
+	completed State
+	next      *transitiveItem
+}
+
+// Option configures a parser created by New
+type Option func(p *realParser)
+
+// WithSync declares synchronisation terminals such as ';' or '}'. When recovering
+// from a syntax error, a rule expecting one of them may skip the input up to its
+// next occurrence, the symbols before it being missing.
+func WithSync(terminals ...Terminal) Option {
+	return func(p *realParser) {
+		for _, t := range terminals {
+			p.sync[t] = true
+		}
 	}
-	p.BT[state] = append(p.BT[state], completedBy)
 }
 
-func (p *realParser) InsertState(state State) {
-	for i := len(p.S) - 1; i < state.k; i++ {
-		p.S = append(p.S, NewOrderedSet[State]())
+// WithTracer reports the predictions, scans and completions of every parse to t,
+// instead of the tracer of the grammar
+func WithTracer(t Tracer) Option {
+	return func(p *realParser) {
+		p.tracer = t
 	}
-	p.S[state.k].Insert(state)
 }
 
-func (p *realParser) Predict(k int, state State) {
-	nextSym := state.NextSym()
-	if nextSym == nil {
-		return
+// chartItem describes a state of set k to the tracer
+func (c *chart) chartItem(k int, state State) ChartItem {
+	item := &c.items[state.item]
+	return ChartItem{Rule: item.rule, Dot: item.dot, Text: item.String(), Origin: state.origin, Pos: k}
+}
+
+func (c *chart) predict(k int, state State) {
+	v := c.items[state.item].waitsFor
+	for _, item := range c.predictions[v] {
+		predicted := State{item: item, origin: k}
+		if c.insert(k, predicted) && c.tracer != nil {
+			c.tracer.Trace(PredictEvent{ChartItem: c.chartItem(k, predicted)})
+		}
 	}
-	ref, ok := nextSym.(RuleRef)
-	if !ok {
-		return
+	// Aycock and Horspool: a nullable variable may be completed in this set before
+	// the state waiting for it is added, which then advances over it right away
+	if c.nullable[v] {
+		c.insert(k, state.advance())
 	}
+}
 
-	for _, production := range p.gram.RulesMap[ref.Variable] {
-		p.InsertState(State{
-			k:              k,
-			variable:       ref.Variable,
-			rule:           production,
-			position:       0,
-			originPosition: k,
-		})
+// scan advances the states of set k expecting a terminal matching the input
+func (c *chart) scan(k int) {
+	s := &c.S[k]
+	for _, sym := range s.terminals {
+		width := c.match(k, sym)
+		if width < 0 {
+			continue
+		}
+		next := k + width
+		t, _ := TerminalOf(sym)
+		for _, state := range s.scanning[t] {
+			if c.insert(next, state.advance()) && c.tracer != nil {
+				c.tracer.Trace(ScanEvent{ChartItem: c.chartItem(next, state.advance()), Terminal: t})
+			}
+		}
 	}
 }
 
-func (p *realParser) Scan(k int, input string, state State) bool {
-	nextSym := state.NextSym()
-	if nextSym == nil {
-		return false
-	}
-	ref, ok := nextSym.(string)
-	if !ok {
-		return false
+func (c *chart) complete(k int, state State) {
+	if c.tracer != nil {
+		c.tracer.Trace(CompleteEvent{ChartItem: c.chartItem(k, state)})
 	}
-	_, found := strings.CutPrefix(input, ref)
-	if found {
-		s := state.IncrementPosition().IncrementK()
-		for _, btState := range p.BT[state] {
-			p.InsertBT(s, btState)
+	v := c.items[state.item].lhs
+	// Sets before k are final, the set of a variable derived from k is not
+	if c.leo && state.origin < k {
+		if t := c.transitiveItem(state.origin, v); t != nil {
+			c.insert(k, t.top)
+			c.reduced[k] = append(c.reduced[k], t)
+			return
 		}
-		p.InsertState(s)
-		return true
 	}
-	return false
+	for _, waiting := range c.S[state.origin].waiting[v] {
+		c.insert(k, waiting.advance())
+	}
 }
 
-func (p *realParser) Complete(k int, state State) {
-	if !state.IsComplete() {
-		return
+// transitiveItem returns the transitive item of set i for the variable v, nil if
+// the set does not hold exactly one item expecting v, as the last symbol of its rule
+func (c *chart) transitiveItem(i int, v int) *transitiveItem {
+	if c.transitive[i] == nil {
+		c.transitive[i] = make(map[int]*transitiveItem)
 	}
-	for _, kState := range p.S[state.originPosition].Data {
-		if ref, ok := kState.NextSym().(RuleRef); ok && ref.Variable == state.variable {
-			newKState := kState.IncrementPosition()
-			newKState.k = k
-			for _, btState := range p.BT[kState] {
-				p.InsertBT(newKState, btState)
-			}
-			p.InsertBT(newKState, &state)
-			p.InsertState(newKState)
-		}
+	if t, ok := c.transitive[i][v]; ok {
+		return t
+	}
+	// Unit rules may lead back to v, whose path then stops there
+	c.transitive[i][v] = nil
+
+	waiting := c.S[i].waiting[v]
+	if len(waiting) != 1 || c.items[waiting[0].item+1].next != nil {
+		return nil
+	}
+	completed := waiting[0].advance()
+	t := &transitiveItem{top: completed, completed: completed}
+	if next := c.transitiveItem(completed.origin, c.items[completed.item].lhs); next != nil {
+		t.top = next.top
+		t.next = next
 	}
+	c.transitive[i][v] = t
+	return t
 }
 
 func (p *realParser) Parse(input string) ([]int, error) {
-	p.S = make([]OrderedSet[State], 0)
-	p.BT = make(map[State][]*State)
+	tree, err := p.ParseTree(input)
+	if err != nil {
+		return nil, err
+	}
+	return tree.LeftParse(), nil
+}
 
-	// _P -> •S
-	startState := State{
-		k:              0,
-		variable:       "_P",
-		rule:           &Expr{Ref(p.gram.StartVariable())},
-		position:       0,
-		originPosition: 0,
+func (p *realParser) ParseTokens(tokens []Token) ([]int, error) {
+	tree, err := p.ParseTokensTree(tokens)
+	if err != nil {
+		return nil, err
 	}
-	// _P -> S•
+	return tree.LeftParse(), nil
+}
 
-	// Add the first state
-	p.InsertState(startState)
+func (p *realParser) ParseTree(input string) (*ParseTree, error) {
+	forest, err := p.ParseForest(input)
+	if err != nil {
+		return nil, err
+	}
+	return forest.Tree(), nil
+}
 
-	// maxK := len(p.input)
-	for k := 0; k >= 0; k++ {
-		if k >= len(p.S) {
-			break
-		}
-		for i := 0; i < len(p.S[k].Data); i++ {
-			state := p.S[k].Data[i]
-			if state.IsComplete() {
-				p.Complete(k, state)
-			} else {
-				switch state.NextSym().(type) {
-				case string:
-					if k >= len(input) {
-						p.Scan(k, "", state)
-					} else {
-						p.Scan(k, input[k:], state)
-					}
-				case RuleRef:
-					p.Predict(k, state)
-				}
-			}
-		}
+func (p *realParser) ParseTokensTree(tokens []Token) (*ParseTree, error) {
+	forest, err := p.ParseTokensForest(tokens)
+	if err != nil {
+		return nil, err
 	}
-	p.PrintState()
+	return forest.Tree(), nil
+}
 
-	finalState := startState.IncrementPosition()
-	finalState.k = len(p.S) - 1
+func (p *realParser) ParseForest(input string) (*Forest, error) {
+	return p.inputChart(input).parse()
+}
 
-	if !p.S[len(p.S)-1].Contains(finalState) || len(p.S) != len(input)+1 {
-		return nil, errors.New("State did not end with completion")
-	}
+func (p *realParser) ParseTokensForest(tokens []Token) (*Forest, error) {
+	return p.tokenChart(tokens).parse()
+}
 
-	return p.GenerateLeftParse(finalState), nil
+func (p *realParser) ParseRecover(input string) (*ParseTree, []*ParseError) {
+	return p.inputChart(input).parseRecover()
 }
 
-func (p *realParser) GenerateLeftParse(state State) []int {
-	var leftParse []int
-	var i int
+func (p *realParser) ParseTokensRecover(tokens []Token) (*ParseTree, []*ParseError) {
+	return p.tokenChart(tokens).parseRecover()
+}
 
-	if ruleNum, ok := p.ruleOrder[state.rule]; ok {
-		leftParse = append(leftParse, *ruleNum)
+// inputChart returns a chart matching terminals literally against raw input,
+// its positions being byte offsets
+func (p *realParser) inputChart(input string) *chart {
+	c := p.newChart(len(input))
+	c.match = func(k int, sym Symbol) int {
+		if class, ok := sym.(CharClass); ok {
+			r, size := utf8.DecodeRuneInString(input[k:])
+			if size > 0 && class.Match(r) {
+				return size
+			}
+			return -1
+		}
+		t, ok := TerminalOf(sym)
+		if !ok || !strings.HasPrefix(input[k:], t.String()) {
+			return -1
+		}
+		return len(t)
+	}
+	c.before = func(j int, sym Symbol) int {
+		if _, ok := sym.(CharClass); ok {
+			_, size := utf8.DecodeLastRuneInString(input[:j])
+			return j - size
+		}
+		t, _ := TerminalOf(sym)
+		return j - len(t)
+	}
+	c.skip = func(k int) int {
+		_, size := utf8.DecodeRuneInString(input[k:])
+		return k + size
 	}
+	c.span = func(i, j int) Span {
+		return Span{Start: i, End: j}
+	}
+	c.unexpected = func(k int, expected []Terminal) *ParseError {
+		return UnexpectedInput(input, k, expected)
+	}
+	return c
+}
 
-	states := p.BT[state]
-	for _, sym := range *state.rule {
+// tokenChart returns a chart matching terminals against token kinds, its
+// positions being token indices
+func (p *realParser) tokenChart(tokens []Token) *chart {
+	c := p.newChart(len(tokens))
+	c.match = func(k int, sym Symbol) int {
+		if k >= len(tokens) {
+			return -1
+		}
 		switch v := sym.(type) {
-		case string:
-			fmt.Print(v)
-		case RuleRef:
-			leftParse = append(leftParse, p.GenerateLeftParse(*states[i])...)
-			i++
+		case Literal:
+			if tokens[k].Kind == Terminal(v) {
+				return 1
+			}
+		case Terminal:
+			if tokens[k].Kind == v {
+				return 1
+			}
+		case CharClass:
+			// A class matches the tokens whose kind is one of its characters
+			r, size := utf8.DecodeRuneInString(tokens[k].Kind.String())
+			if size > 0 && size == len(tokens[k].Kind) && v.Match(r) {
+				return 1
+			}
+		}
+		return -1
+	}
+	c.before = func(j int, sym Symbol) int {
+		return j - 1
+	}
+	c.skip = func(k int) int {
+		return k + 1
+	}
+	c.span = func(i, j int) Span {
+		if len(tokens) == 0 {
+			return Span{}
+		}
+		if i >= len(tokens) {
+			end := tokens[len(tokens)-1].Span.End
+			return Span{Start: end, End: end}
 		}
+		if i == j {
+			return Span{Start: tokens[i].Span.Start, End: tokens[i].Span.Start}
+		}
+		return Span{Start: tokens[i].Span.Start, End: tokens[j-1].Span.End}
+	}
+	c.unexpected = func(k int, expected []Terminal) *ParseError {
+		return UnexpectedToken(tokens, k, expected)
 	}
-	return leftParse
+	return c
 }
 
-func (p *realParser) PrintState() {
-	for k, set := range p.S {
-		fmt.Printf("S(%d):\n", k)
-		for _, state := range set.Data {
-			fmt.Println(state.String())
+// parse runs the parser over the input, scanning terminals through c.match
+func (c *chart) parse() (*Forest, error) {
+	// _P -> •S
+	c.insert(0, State{item: c.start, origin: 0})
+	for k := 0; k <= c.last; k++ {
+		s := &c.S[k]
+		for i := 0; i < len(s.states); i++ {
+			state := s.states[i]
+			switch item := &c.items[state.item]; {
+			case item.next == nil:
+				c.complete(k, state)
+			case item.waitsFor >= 0:
+				c.predict(k, state)
+			}
 		}
+		c.scan(k)
 	}
 
-	fmt.Println("Completed:")
-	for key, value := range p.BT {
-		fmt.Printf("%+v %+v\n", key.String(), value)
+	// _P -> S•
+	if !c.S[c.n].contains(State{item: c.start + 1, origin: 0}) {
+		return nil, c.parseError(c.last)
+	}
+
+	return c.BuildForest(), nil
+}
+
+// parseError returns the error located at the furthest set k of the chart,
+// expecting the terminals its states would have scanned
+func (c *chart) parseError(k int) *ParseError {
+	var expected []Terminal
+	for _, sym := range c.S[k].terminals {
+		t, _ := TerminalOf(sym)
+		expected = append(expected, t)
+	}
+	if c.S[k].contains(State{item: c.start + 1, origin: 0}) {
+		expected = append(expected, EndOfInput)
+	}
+	slices.Sort(expected)
+	err := c.unexpected(k, slices.Compact(expected))
+	err.Context = c.context(k)
+	return err
+}
+
+// context returns the variables being recognised at set k, outermost first,
+// following the first partially recognised rule back to the states that predicted it
+func (c *chart) context(k int) []Variable {
+	var state *State
+	for i := range c.S[k].states {
+		s := &c.S[k].states[i]
+		if item := &c.items[s.item]; item.dot > 0 && item.next != nil && item.rule >= 0 {
+			state = s
+			break
+		}
+	}
+	var context []Variable
+	seen := make(map[State]bool)
+	for state != nil && c.items[state.item].rule >= 0 && !seen[*state] {
+		seen[*state] = true
+		item := &c.items[state.item]
+		context = append(context, item.variable)
+		waiting := c.S[state.origin].waiting[item.lhs]
+		state = nil
+		if len(waiting) > 0 {
+			state = &waiting[0]
+		}
 	}
+	slices.Reverse(context)
+	return context
 }
 
-func New(gram *Grammar) Parser {
-	ruleOrder := make(map[*Expr]*int)
-	for k, rule := range gram.Rules {
-		ruleOrder[&rule.Expr] = &k
+func New(gram *Grammar, opts ...Option) RecoveringParser {
+	p := &realParser{
+		gram:   gram,
+		sync:   make(map[Terminal]bool),
+		tracer: gram.Tracer,
+		leo:    true,
 	}
-	return &realParser{
-		gram:      gram,
-		ruleOrder: ruleOrder,
+	p.compile()
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
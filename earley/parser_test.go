@@ -1,21 +1,38 @@
 package earley
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
 
 	. "github.com/costowell/parsing-fun/common"
+	"github.com/costowell/parsing-fun/internal/parsertest"
 )
 
+func TestSuite(t *testing.T) {
+	parsertest.Run(t, func(g *Grammar) (Parser, error) {
+		return New(g), nil
+	})
+}
+
+func TestConcurrent(t *testing.T) {
+	parsertest.RunConcurrent(t, func(g *Grammar) (Parser, error) {
+		return New(g), nil
+	})
+}
+
 func TestOperatorPrecedence(t *testing.T) {
 	rules := []Rule{
-		NewRule("S", Expr{Ref("S"), "+", Ref("M")}),
+		NewRule("S", Expr{Ref("S"), Literal("+"), Ref("M")}),
 		NewRule("S", Expr{Ref("M")}),
-		NewRule("M", Expr{Ref("M"), "*", Ref("T")}),
+		NewRule("M", Expr{Ref("M"), Literal("*"), Ref("T")}),
 		NewRule("M", Expr{Ref("T")}),
-		NewRule("T", Expr{"1"}),
-		NewRule("T", Expr{"2"}),
-		NewRule("T", Expr{"3"}),
-		NewRule("T", Expr{"4"}),
+		NewRule("T", Expr{Literal("1")}),
+		NewRule("T", Expr{Literal("2")}),
+		NewRule("T", Expr{Literal("3")}),
+		NewRule("T", Expr{Literal("4")}),
 	}
 	g, err := NewGrammar(rules)
 	if err != nil {
@@ -90,3 +107,494 @@ func TestOperatorPrecedence(t *testing.T) {
 		})
 	}
 }
+
+func TestGeneratedSentences(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("S", Expr{Ref("S"), Literal("+"), Ref("M")}),
+		NewRule("S", Expr{Ref("M")}),
+		NewRule("M", Expr{Ref("M"), Literal("*"), Ref("T")}),
+		NewRule("M", Expr{Ref("T")}),
+		NewRule("T", Expr{Literal("("), Ref("S"), Literal(")")}),
+		NewRule("T", Expr{Literal("1")}),
+		NewRule("T", Expr{Literal("2")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	gen, err := NewGenerator(g, WithSeed(1), WithLength(15), WithLeftParse())
+	if err != nil {
+		t.Fatalf("NewGenerator() unexpected error: %v", err)
+	}
+	parser := New(g)
+	for range 50 {
+		s := gen.Generate()
+		leftParse, err := parser.Parse(s.String())
+		if err != nil {
+			t.Fatalf("Parse(%q) unexpected error: %v", s, err)
+		}
+		if !slices.Equal(leftParse, s.LeftParse) {
+			t.Errorf("Parse(%q) = %v, generated by %v", s, leftParse, s.LeftParse)
+		}
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	rules := []Rule{
+		NewRule("E", Expr{Ref("E"), Literal("+"), Ref("T")}),
+		NewRule("E", Expr{Ref("T")}),
+		NewRule("T", Expr{Terminal("NUM")}),
+		NewRule("T", Expr{Literal("("), Ref("E"), Literal(")")}),
+	}
+	g, err := NewGrammar(rules)
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	lexer, err := NewRegexLexer([]TokenDef{
+		{Kind: "WS", Pattern: `\s+`, Skip: true},
+		{Kind: "NUM", Pattern: `[0-9]+`},
+		{Kind: "+", Pattern: `\+`},
+		{Kind: "(", Pattern: `\(`},
+		{Kind: ")", Pattern: `\)`},
+	})
+	if err != nil {
+		t.Fatalf("NewRegexLexer() unexpected error: %v", err)
+	}
+	parser := New(g)
+	tests := []struct {
+		name        string
+		input       string
+		expected    []int
+		expectError bool
+	}{
+		{
+			name:     "single",
+			input:    "42",
+			expected: []int{1, 2},
+		},
+		{
+			name:     "sum",
+			input:    "12 + (3 + 456)",
+			expected: []int{0, 1, 2, 3, 0, 1, 2, 2},
+		},
+		{
+			name:        "unbalanced",
+			input:       "(1 + 2",
+			expectError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lexer.Tokenize(tt.input)
+			if err != nil {
+				t.Fatalf("Tokenize() unexpected error: %v", err)
+			}
+			leftParse, err := parser.ParseTokens(tokens)
+			if !tt.expectError && err != nil {
+				t.Errorf("ParseTokens() unexpected error: %v", err)
+			}
+			if tt.expectError && err == nil {
+				t.Errorf("ParseTokens() expected error, got none")
+			}
+			if err != nil {
+				return
+			}
+			if len(leftParse) != len(tt.expected) {
+				t.Fatalf("ParseTokens() = %v, want %v", leftParse, tt.expected)
+			}
+			for i := range leftParse {
+				if leftParse[i] != tt.expected[i] {
+					t.Fatalf("ParseTokens() = %v, want %v", leftParse, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	rules := []Rule{
+		NewRule("E", Expr{Ref("E"), Literal("+"), Ref("T")}),
+		NewRule("E", Expr{Ref("T")}),
+		NewRule("T", Expr{Terminal("NUM")}),
+	}
+	g, err := NewGrammar(rules)
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	lexer, err := NewRegexLexer([]TokenDef{
+		{Kind: "WS", Pattern: `\s+`, Skip: true},
+		{Kind: "NUM", Pattern: `[0-9]+`},
+		{Kind: "+", Pattern: `\+`},
+	})
+	if err != nil {
+		t.Fatalf("NewRegexLexer() unexpected error: %v", err)
+	}
+
+	input := "10 + 200 + 3"
+	tokens, err := lexer.Tokenize(input)
+	if err != nil {
+		t.Fatalf("Tokenize() unexpected error: %v", err)
+	}
+	tree, err := New(g).ParseTokensTree(tokens)
+	if err != nil {
+		t.Fatalf("ParseTokensTree() unexpected error: %v", err)
+	}
+
+	if tree.Variable != "E" || tree.Rule != 0 || tree.Text(input) != input {
+		t.Errorf("ParseTokensTree() unexpected root %v", tree)
+	}
+	var numbers []string
+	for _, node := range tree.Find("T") {
+		numbers = append(numbers, node.Text(input))
+	}
+	expected := []string{"10", "200", "3"}
+	if len(numbers) != len(expected) {
+		t.Fatalf("Find() = %v, want %v", numbers, expected)
+	}
+	for i := range expected {
+		if numbers[i] != expected[i] {
+			t.Errorf("Find()[%d] = %v, want %v", i, numbers[i], expected[i])
+		}
+	}
+	if left := tree.Children[0].Text(input); left != "10 + 200" {
+		t.Errorf("left operand = %q, want %q", left, "10 + 200")
+	}
+}
+
+func TestMultiCharTerminals(t *testing.T) {
+	rules := []Rule{
+		NewRule("S", Expr{Literal("while"), Ref("C"), Literal("do"), Ref("S")}),
+		NewRule("S", Expr{Literal("x")}),
+		NewRule("S", Expr{Literal("λ→"), Ref("S")}),
+		NewRule("C", Expr{Literal("x")}),
+		NewRule("C", Expr{Literal("xé")}),
+		NewRule("C", Expr{Literal("é")}),
+	}
+	g, err := NewGrammar(rules)
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	parser := New(g)
+	tests := []struct {
+		name        string
+		input       string
+		expected    []int
+		expectError bool
+	}{
+		{
+			name:     "keywords",
+			input:    "whilexdox",
+			expected: []int{0, 3, 1},
+		},
+		{
+			name:     "nested keywords",
+			input:    "whileédowhilexdox",
+			expected: []int{0, 5, 0, 3, 1},
+		},
+		{
+			name:     "overlapping terminals",
+			input:    "whilexédox",
+			expected: []int{0, 4, 1},
+		},
+		{
+			name:     "non-ASCII",
+			input:    "λ→λ→whileédox",
+			expected: []int{2, 2, 0, 5, 1},
+		},
+		{
+			name:        "partial keyword",
+			input:       "whilxdox",
+			expectError: true,
+		},
+		{
+			name:        "partial character",
+			input:       "λ→\xce",
+			expectError: true,
+		},
+		{
+			name:        "trailing input",
+			input:       "xdo",
+			expectError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := parser.ParseTree(tt.input)
+			if !tt.expectError && err != nil {
+				t.Fatalf("ParseTree() unexpected error: %v", err)
+			}
+			if tt.expectError && err == nil {
+				t.Fatalf("ParseTree() expected error, got none")
+			}
+			if err != nil {
+				return
+			}
+			if leftParse := tree.LeftParse(); !slices.Equal(leftParse, tt.expected) {
+				t.Errorf("ParseTree() left parse = %v, want %v", leftParse, tt.expected)
+			}
+			// Leaves cover the bytes of their terminal
+			var text string
+			tree.Walk(func(node *ParseTree) bool {
+				if node.IsLeaf() {
+					if node.Text(tt.input) != node.Terminal.String() {
+						t.Errorf("ParseTree() leaf %v covers %q", node.Terminal, node.Text(tt.input))
+					}
+					text += node.Text(tt.input)
+				}
+				return true
+			})
+			if text != tt.input || tree.Span != (Span{Start: 0, End: len(tt.input)}) {
+				t.Errorf("ParseTree() covers %q in %v, want %q", text, tree.Span, tt.input)
+			}
+		})
+	}
+}
+
+func TestCharClasses(t *testing.T) {
+	rules := []Rule{
+		NewRule("List", Expr{Ref("List"), Literal(","), Ref("Item")}),
+		NewRule("List", Expr{Ref("Item")}),
+		NewRule("Item", Expr{Ref("Ident")}),
+		NewRule("Item", Expr{Ref("Number")}),
+		NewRule("Ident", Expr{CharClass(`[\p{L}_]`), Ref("Rest")}),
+		NewRule("Rest", Expr{CharClass(`[\p{L}\d_]`), Ref("Rest")}),
+		NewRule("Rest", Expr{}),
+		NewRule("Number", Expr{Ref("Number"), CharClass("[0-9]")}),
+		NewRule("Number", Expr{CharClass("[0-9]")}),
+	}
+	g, err := NewGrammar(rules)
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	parser := New(g)
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+		err      string
+	}{
+		{
+			name:     "identifiers and numbers",
+			input:    "x,42,_a1",
+			expected: []string{"x", "42", "_a1"},
+		},
+		{
+			name:     "non-ASCII letters",
+			input:    "été,λ2",
+			expected: []string{"été", "λ2"},
+		},
+		{
+			name:  "number then letter",
+			input: "1a",
+			err:   "Unexpected 'a' at 1:2, expected one of end of input, ',', '[0-9]' while parsing List > Item > Number",
+		},
+		{
+			name:  "negated by the class",
+			input: "x,-",
+			err:   "Unexpected '-' at 1:3, expected one of '[0-9]', '[\\p{L}_]' while parsing List",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := parser.ParseTree(tt.input)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("ParseTree() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTree() unexpected error: %v", err)
+			}
+			var items []string
+			for _, node := range tree.Find("Item") {
+				items = append(items, node.Text(tt.input))
+			}
+			if !slices.Equal(items, tt.expected) {
+				t.Errorf("Find(Item) = %q, want %q", items, tt.expected)
+			}
+			// Leaves of classes cover a single character they match
+			tree.Walk(func(node *ParseTree) bool {
+				if class, ok := node.Terminal.(CharClass); ok && node.IsLeaf() {
+					if r := []rune(node.Text(tt.input)); len(r) != 1 || !class.Match(r[0]) {
+						t.Errorf("ParseTree() leaf %v covers %q", class, node.Text(tt.input))
+					}
+				}
+				return true
+			})
+		})
+	}
+
+	tokens := []Token{{Kind: "4", Span: Span{Start: 0, End: 1}}, {Kind: ",", Span: Span{Start: 1, End: 2}}, {Kind: "é", Span: Span{Start: 2, End: 4}}}
+	if leftParse, err := parser.ParseTokens(tokens); err != nil || !slices.Equal(leftParse, []int{0, 1, 3, 8, 2, 4, 6}) {
+		t.Errorf("ParseTokens() = %v, %v", leftParse, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	rules := []Rule{
+		NewRule("S", Expr{Ref("S"), Literal("+"), Ref("M")}),
+		NewRule("S", Expr{Ref("M")}),
+		NewRule("M", Expr{Ref("M"), Literal("*"), Ref("T")}),
+		NewRule("M", Expr{Ref("T")}),
+		NewRule("T", Expr{Literal("("), Ref("S"), Literal(")")}),
+		NewRule("T", Expr{Literal("1")}),
+		NewRule("T", Expr{Literal("2")}),
+	}
+	g, err := NewGrammar(rules)
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	parser := New(g)
+	tests := []struct {
+		input    string
+		offset   int
+		expected []Terminal
+		context  []Variable
+		err      string
+	}{
+		{
+			input:    "",
+			expected: []Terminal{"(", "1", "2"},
+			err:      "Unexpected end of input at 1:1, expected one of '(', '1', '2'",
+		},
+		{
+			input:    "1+",
+			offset:   2,
+			expected: []Terminal{"(", "1", "2"},
+			context:  []Variable{"S"},
+			err:      "Unexpected end of input at 1:3, expected one of '(', '1', '2' while parsing S",
+		},
+		{
+			input:    "1+2*",
+			offset:   4,
+			expected: []Terminal{"(", "1", "2"},
+			context:  []Variable{"S", "M"},
+			err:      "Unexpected end of input at 1:5, expected one of '(', '1', '2' while parsing S > M",
+		},
+		{
+			input:    "(1+2))",
+			offset:   5,
+			expected: []Terminal{EndOfInput, "*", "+"},
+			context:  []Variable{"S", "M"},
+			err:      "Unexpected ')' at 1:6, expected one of end of input, '*', '+' while parsing S > M",
+		},
+		{
+			input:    "1\t2",
+			offset:   1,
+			expected: []Terminal{EndOfInput, "*", "+"},
+			context:  []Variable{"S", "M"},
+			err:      "Unexpected '\\t' at 1:2, expected one of end of input, '*', '+' while parsing S > M",
+		},
+		{
+			input:    "ü",
+			expected: []Terminal{"(", "1", "2"},
+			err:      "Unexpected 'ü' at 1:1, expected one of '(', '1', '2'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := parser.Parse(tt.input)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse() error = %v, want a *ParseError", err)
+			}
+			if parseErr.Offset != tt.offset || !slices.Equal(parseErr.Expected, tt.expected) || !slices.Equal(parseErr.Context, tt.context) {
+				t.Errorf("Parse() error = %+v, want offset %d, expected %v, context %v", parseErr, tt.offset, tt.expected, tt.context)
+			}
+			if err.Error() != tt.err {
+				t.Errorf("Parse() error = %q, want %q", err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	g, err := NewGrammar([]Rule{
+		NewRule("S", Expr{Ref("S"), Literal("+"), Ref("M")}),
+		NewRule("S", Expr{Ref("M")}),
+		NewRule("M", Expr{Ref("M"), Literal("*"), Ref("T")}),
+		NewRule("M", Expr{Ref("T")}),
+		NewRule("T", Expr{Literal("("), Ref("S"), Literal(")")}),
+		NewRule("T", Expr{Terminal("NUM")}),
+		NewRule("T", Expr{Literal("1")}),
+		NewRule("T", Expr{Literal("2")}),
+		NewRule("T", Expr{Literal("3")}),
+	})
+	if err != nil {
+		b.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	lexer, err := NewRegexLexer([]TokenDef{
+		{Kind: "WS", Pattern: `\s+`, Skip: true},
+		{Kind: "NUM", Pattern: `[0-9]+`},
+		{Kind: "+", Pattern: `\+`},
+		{Kind: "*", Pattern: `\*`},
+		{Kind: "(", Pattern: `\(`},
+		{Kind: ")", Pattern: `\)`},
+	})
+	if err != nil {
+		b.Fatalf("NewRegexLexer() unexpected error: %v", err)
+	}
+	// expression returns an expression of about size bytes
+	expression := func(term string, size int) string {
+		return strings.Repeat(term+"+", size/(len(term)+1)) + "1"
+	}
+
+	for _, size := range []int{4 << 10, 16 << 10} {
+		input := expression("(1+2)*3+2*(3+1)", size)
+		b.Run(fmt.Sprintf("input/%dKiB", size>>10), func(b *testing.B) {
+			p := New(g)
+			b.SetBytes(int64(len(input)))
+			for b.Loop() {
+				if _, err := p.ParseTree(input); err != nil {
+					b.Fatalf("ParseTree() unexpected error: %v", err)
+				}
+			}
+		})
+
+		text := expression("(12 + 3) * 456 + 7 * (89 + 1)", size)
+		tokens, err := lexer.Tokenize(text)
+		if err != nil {
+			b.Fatalf("Tokenize() unexpected error: %v", err)
+		}
+		b.Run(fmt.Sprintf("tokens/%dKiB", size>>10), func(b *testing.B) {
+			p := New(g)
+			b.SetBytes(int64(len(text)))
+			for b.Loop() {
+				if _, err := p.ParseTokensTree(tokens); err != nil {
+					b.Fatalf("ParseTokensTree() unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("S", Expr{Ref("S"), Literal("+"), Literal("1")}),
+		NewRule("S", Expr{Literal("1")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	var events []string
+	p := New(g, WithTracer(TracerFunc(func(event Event) {
+		events = append(events, event.String())
+	})))
+	if _, err := p.Parse("1+1"); err != nil {
+		t.Fatalf("Parse() unexpected error: %v", err)
+	}
+	expected := []string{
+		"predict (S -> •S '+' '1' , 0..0)",
+		"predict (S -> •'1' , 0..0)",
+		"scan '1' (S -> '1' •, 0..1)",
+		"complete (S -> '1' •, 0..1)",
+		"complete (_P -> S •, 0..1)",
+		"scan '+' (S -> S '+' •'1' , 0..2)",
+		"scan '1' (S -> S '+' '1' •, 0..3)",
+		"complete (S -> S '+' '1' •, 0..3)",
+		"complete (_P -> S •, 0..3)",
+	}
+	if !slices.Equal(events, expected) {
+		t.Errorf("Parse() traced\n%s\nwant\n%s", strings.Join(events, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -0,0 +1,405 @@
+package earley
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+// Costs of the edits error recovery makes to the input, a missing terminal is
+// assumed rather than a character or token skipped when both repair the input
+const (
+	insertCost = 2
+	deleteCost = 3
+	// syncCost is the cost of skipping to a synchronisation terminal, however long the skipped input
+	syncCost = 4
+)
+
+// item is a chart item of error recovery, rule -1 being _P -> S
+type item struct {
+	rule   int
+	dot    int
+	origin int
+}
+
+type itemKey struct {
+	k    int
+	item item
+}
+
+type step int
+
+const (
+	predicted step = iota
+	scanned
+	inserted
+	deleted
+	synced
+	completed
+)
+
+// entry is the cheapest derivation of an item found so far, the item being
+// reached from prev by step
+type entry struct {
+	// cost is the cost of the edits within the item, prefix the least cost of
+	// the edits from the start of the input to the end of the item
+	cost   int
+	prefix int
+	step   step
+	prev   itemKey
+	// child is the completed item of a completion
+	child itemKey
+	// at is the position of the synchronisation terminal a sync skipped to
+	at int
+}
+
+// diagnostic is an error of the repaired derivation over the positions [start, end)
+type diagnostic struct {
+	start   int
+	end     int
+	prefix  int
+	context []Variable
+}
+
+// recovery is a least-errors Earley parser: next to scanning, items may skip a
+// character or token, assume a missing terminal or skip to a synchronisation
+// terminal, at a cost. Every set keeps the cheapest derivation of each item.
+// Edits are only made where an error is detected, in sets whose cheapest items
+// cannot scan the input, so repairs are not moved back before the error.
+type recovery struct {
+	c     *chart
+	n     int
+	sets  []map[item]*entry
+	order [][]item
+	// work holds the items of the current set whose cost changed
+	work []item
+	// editing tells whether edits are made in the current set
+	editing bool
+	rules   map[Variable][]int
+	// next caches for synchronisation terminals the position of their next occurrence
+	next        map[Terminal][]int
+	diagnostics []diagnostic
+}
+
+// parseRecover parses an input of length n, repairing it at the least cost if
+// it is not in the language
+func (c *chart) parseRecover() (*ParseTree, []*ParseError) {
+	forest, err := c.parse()
+	if err == nil {
+		return forest.Tree(), nil
+	}
+	var parseErr *ParseError
+	errors.As(err, &parseErr)
+
+	r := &recovery{
+		c:     c,
+		n:     c.n,
+		sets:  make([]map[item]*entry, c.n+1),
+		order: make([][]item, c.n+1),
+		rules: make(map[Variable][]int),
+		next:  make(map[Terminal][]int),
+	}
+	for i := range r.sets {
+		r.sets[i] = make(map[item]*entry)
+	}
+	for i, rule := range c.gram.Rules {
+		r.rules[rule.Variable] = append(r.rules[rule.Variable], i)
+	}
+
+	r.add(0, 0, item{rule: -1}, entry{step: predicted})
+	for k := 0; k <= c.n; k++ {
+		r.editing = false
+		r.run(k)
+		if !r.scannable(k) {
+			r.editing = true
+			r.run(k)
+		}
+	}
+
+	final := itemKey{k: c.n, item: item{rule: -1, dot: 1}}
+	if _, ok := r.sets[c.n][final.item]; !ok {
+		// Only an unproductive start variable derives no repair
+		return nil, []*ParseError{parseErr}
+	}
+	return r.tree(final), r.errors()
+}
+
+// run processes the items of set k until their costs settle
+func (r *recovery) run(k int) {
+	r.work = slices.Clone(r.order[k])
+	for len(r.work) > 0 {
+		it := r.work[0]
+		r.work = r.work[1:]
+		r.process(k, it)
+	}
+}
+
+// scannable returns whether one of the cheapest items of set k scans the input
+func (r *recovery) scannable(k int) bool {
+	least := -1
+	for _, it := range r.order[k] {
+		if e := r.sets[k][it]; least < 0 || e.prefix < least {
+			least = e.prefix
+		}
+	}
+	for _, it := range r.order[k] {
+		sym := r.nextSym(it)
+		if _, ok := TerminalOf(sym); ok && r.sets[k][it].prefix == least && k < r.n && r.c.match(k, sym) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *recovery) expr(rule int) Expr {
+	if rule < 0 {
+		return Expr{Ref(r.c.gram.StartVariable())}
+	}
+	return r.c.gram.Rules[rule].Expr
+}
+
+func (r *recovery) variable(rule int) Variable {
+	if rule < 0 {
+		return "_P"
+	}
+	return r.c.gram.Rules[rule].Variable
+}
+
+// add records a derivation of an item in set k, current being the set being
+// processed. Items are processed again when their cost or prefix cost lowers.
+func (r *recovery) add(current, k int, it item, e entry) {
+	old, ok := r.sets[k][it]
+	switch {
+	case !ok:
+		r.sets[k][it] = &e
+		r.order[k] = append(r.order[k], it)
+	case e.cost < old.cost:
+		e.prefix = min(e.prefix, old.prefix)
+		*old = e
+	case e.prefix < old.prefix:
+		old.prefix = e.prefix
+	default:
+		return
+	}
+	if k == current {
+		r.work = append(r.work, it)
+	}
+}
+
+func (r *recovery) process(k int, it item) {
+	key := itemKey{k: k, item: it}
+	cost, prefix := r.sets[k][it].cost, r.sets[k][it].prefix
+	expr := r.expr(it.rule)
+	advanced := item{rule: it.rule, dot: it.dot + 1, origin: it.origin}
+
+	if it.dot == len(expr) {
+		v := r.variable(it.rule)
+		for i := 0; i < len(r.order[it.origin]); i++ {
+			waiting := r.order[it.origin][i]
+			if ref, ok := r.nextSym(waiting).(RuleRef); ok && ref.Variable == v {
+				r.add(k, k, item{rule: waiting.rule, dot: waiting.dot + 1, origin: waiting.origin}, entry{
+					cost:   r.sets[it.origin][waiting].cost + cost,
+					prefix: r.sets[it.origin][waiting].prefix + cost,
+					step:   completed,
+					prev:   itemKey{k: it.origin, item: waiting},
+					child:  key,
+				})
+			}
+		}
+	} else if ref, ok := expr[it.dot].(RuleRef); ok {
+		for _, rule := range r.rules[ref.Variable] {
+			r.add(k, k, item{rule: rule, origin: k}, entry{prefix: prefix, step: predicted})
+		}
+		// Variables completed at k from k, deriving ε
+		for i := 0; i < len(r.order[k]); i++ {
+			done := r.order[k][i]
+			if done.origin == k && done.dot == len(r.expr(done.rule)) && r.variable(done.rule) == ref.Variable {
+				r.add(k, k, advanced, entry{
+					cost:   cost + r.sets[k][done].cost,
+					prefix: prefix + r.sets[k][done].cost,
+					step:   completed,
+					prev:   key,
+					child:  itemKey{k: k, item: done},
+				})
+			}
+		}
+	} else {
+		sym := expr[it.dot]
+		if width := r.c.match(k, sym); width >= 0 {
+			r.add(k, k+width, advanced, entry{cost: cost, prefix: prefix, step: scanned, prev: key})
+		}
+		if r.editing {
+			r.add(k, k, advanced, entry{cost: cost + insertCost, prefix: prefix + insertCost, step: inserted, prev: key})
+		}
+	}
+
+	if !r.editing {
+		return
+	}
+	if k < r.n {
+		r.add(k, r.c.skip(k), it, entry{cost: cost + deleteCost, prefix: prefix + deleteCost, step: deleted, prev: key})
+	}
+	for d := it.dot; d < len(expr); d++ {
+		t, ok := TerminalOf(expr[d])
+		if !ok || !r.c.sync[t] {
+			continue
+		}
+		at := r.nextOccurrence(expr[d], k)
+		if at < 0 || (at == k && d == it.dot) {
+			continue
+		}
+		r.add(k, at+r.c.match(at, expr[d]), item{rule: it.rule, dot: d + 1, origin: it.origin}, entry{
+			cost:   cost + syncCost,
+			prefix: prefix + syncCost,
+			step:   synced,
+			prev:   key,
+			at:     at,
+		})
+	}
+}
+
+func (r *recovery) nextSym(it item) Symbol {
+	expr := r.expr(it.rule)
+	if it.dot >= len(expr) {
+		return nil
+	}
+	return expr[it.dot]
+}
+
+// nextOccurrence returns the first position from k where the terminal symbol
+// sym matches, -1 if there is none
+func (r *recovery) nextOccurrence(sym Symbol, k int) int {
+	t, _ := TerminalOf(sym)
+	next, ok := r.next[t]
+	if !ok {
+		next = make([]int, r.n+2)
+		next[r.n+1] = -1
+		for i := r.n; i >= 0; i-- {
+			next[i] = next[i+1]
+			if r.c.match(i, sym) >= 0 {
+				next[i] = i
+			}
+		}
+		r.next[t] = next
+	}
+	return next[k]
+}
+
+// tree builds the repaired parse tree from the final item, input skipped around
+// the start variable is attached to its node
+func (r *recovery) tree(final itemKey) *ParseTree {
+	children := r.children(final, nil)
+	var root *ParseTree
+	var before, after []*ParseTree
+	for _, child := range children {
+		switch {
+		case !child.IsError():
+			root = child
+		case root == nil:
+			before = append(before, child)
+		default:
+			after = append(after, child)
+		}
+	}
+	root.Children = append(append(before, root.Children...), after...)
+	root.Span = r.c.span(0, r.n)
+	return root
+}
+
+// node builds the node of a completed item, context holding the variables of its ancestors
+func (r *recovery) node(key itemKey, context []Variable) *ParseTree {
+	v := r.variable(key.item.rule)
+	return &ParseTree{
+		Rule:     key.item.rule,
+		Variable: v,
+		Span:     r.c.span(key.item.origin, key.k),
+		Children: r.children(key, append(slices.Clip(context), v)),
+	}
+}
+
+// children returns the nodes an item derives, following its derivation back to its prediction
+func (r *recovery) children(key itemKey, context []Variable) []*ParseTree {
+	var pieces [][]*ParseTree
+	for {
+		e := r.sets[key.k][key.item]
+		if e.step == predicted {
+			break
+		}
+		expr := r.expr(key.item.rule)
+		var piece []*ParseTree
+		switch e.step {
+		case scanned:
+			piece = []*ParseTree{NewLeaf(expr[key.item.dot-1], r.c.span(e.prev.k, key.k))}
+		case inserted:
+			piece = []*ParseTree{NewErrorLeaf(expr[key.item.dot-1], r.c.span(key.k, key.k))}
+			r.report(e.prev.k, key.k, r.sets[e.prev.k][e.prev.item].prefix, context)
+		case deleted:
+			piece = []*ParseTree{NewErrorLeaf(nil, r.c.span(e.prev.k, key.k))}
+			r.report(e.prev.k, key.k, r.sets[e.prev.k][e.prev.item].prefix, context)
+		case synced:
+			if e.prev.k < e.at {
+				piece = append(piece, NewErrorLeaf(nil, r.c.span(e.prev.k, e.at)))
+			}
+			for _, sym := range expr[e.prev.item.dot : key.item.dot-1] {
+				piece = append(piece, NewErrorLeaf(sym, r.c.span(e.at, e.at)))
+			}
+			piece = append(piece, NewLeaf(expr[key.item.dot-1], r.c.span(e.at, key.k)))
+			r.report(e.prev.k, e.at, r.sets[e.prev.k][e.prev.item].prefix, context)
+		case completed:
+			piece = []*ParseTree{r.node(e.child, context)}
+		}
+		pieces = append(pieces, piece)
+		key = e.prev
+	}
+	var children []*ParseTree
+	for i := len(pieces) - 1; i >= 0; i-- {
+		children = append(children, pieces[i]...)
+	}
+	return children
+}
+
+func (r *recovery) report(start, end, prefix int, context []Variable) {
+	r.diagnostics = append(r.diagnostics, diagnostic{start: start, end: end, prefix: prefix, context: context})
+}
+
+// errors returns the diagnostics in input order, adjacent ones being merged
+func (r *recovery) errors() []*ParseError {
+	slices.SortStableFunc(r.diagnostics, func(a, b diagnostic) int {
+		return cmp.Compare(a.start, b.start)
+	})
+	var merged []diagnostic
+	for _, d := range r.diagnostics {
+		if last := len(merged) - 1; last >= 0 && d.start <= merged[last].end {
+			merged[last].end = max(merged[last].end, d.end)
+			continue
+		}
+		merged = append(merged, d)
+	}
+
+	errs := make([]*ParseError, len(merged))
+	for i, d := range merged {
+		errs[i] = r.c.unexpected(d.start, r.expected(d.start, d.prefix))
+		errs[i].Context = d.context
+	}
+	return errs
+}
+
+// expected returns the terminals the items of set k reached with edits costing at
+// most prefix would have scanned, those of the error-free chart before the first error
+func (r *recovery) expected(k, prefix int) []Terminal {
+	expected := NewOrderedSet[Terminal]()
+	for _, it := range r.order[k] {
+		if r.sets[k][it].prefix > prefix {
+			continue
+		}
+		if t, ok := TerminalOf(r.nextSym(it)); ok {
+			expected.Insert(t)
+		}
+		if it.rule < 0 && it.dot == 1 {
+			expected.Insert(EndOfInput)
+		}
+	}
+	return slices.Sorted(slices.Values(expected.Data))
+}
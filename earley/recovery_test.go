@@ -0,0 +1,256 @@
+package earley
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+// repaired returns the input a best-effort tree stands for, missing symbols
+// included and skipped input left out, missing variables as <V>
+func repaired(tree *ParseTree, input string) string {
+	var s string
+	tree.Walk(func(node *ParseTree) bool {
+		switch {
+		case node.IsError() && node.Terminal == nil:
+		case node.IsError():
+			if ref, ok := node.Terminal.(RuleRef); ok {
+				s += "<" + ref.Variable.String() + ">"
+			} else {
+				s += fmt.Sprint(node.Terminal)
+			}
+		case node.IsLeaf():
+			s += node.Text(input)
+		}
+		return true
+	})
+	return s
+}
+
+func TestParseRecover(t *testing.T) {
+	expressions := []Rule{
+		NewRule("S", Expr{Ref("S"), Literal("+"), Ref("M")}),
+		NewRule("S", Expr{Ref("M")}),
+		NewRule("M", Expr{Ref("M"), Literal("*"), Ref("T")}),
+		NewRule("M", Expr{Ref("T")}),
+		NewRule("T", Expr{Literal("("), Ref("S"), Literal(")")}),
+		NewRule("T", Expr{Literal("1")}),
+		NewRule("T", Expr{Literal("2")}),
+	}
+	statements := []Rule{
+		NewRule("P", Expr{Ref("St"), Ref("P")}),
+		NewRule("P", Expr{}),
+		NewRule("St", Expr{Literal("x"), Literal("="), Ref("E"), Literal(";")}),
+		NewRule("E", Expr{Ref("E"), Literal("+"), Literal("1")}),
+		NewRule("E", Expr{Literal("1")}),
+	}
+	tests := []struct {
+		name     string
+		rules    []Rule
+		sync     []Terminal
+		input    string
+		repaired string
+		errs     []string
+	}{
+		{
+			name:     "valid",
+			rules:    expressions,
+			input:    "(1+2)*2",
+			repaired: "(1+2)*2",
+		},
+		{
+			name:     "missing operand",
+			rules:    expressions,
+			input:    "1+",
+			repaired: "1+1",
+			errs:     []string{"Unexpected end of input at 1:3, expected one of '(', '1', '2' while parsing S > M > T"},
+		},
+		{
+			name:     "missing parenthesis",
+			rules:    expressions,
+			input:    "(1+2",
+			repaired: "(1+2)",
+			errs:     []string{"Unexpected end of input at 1:5, expected one of ')', '*', '+' while parsing S > M > T"},
+		},
+		{
+			name:     "extra parentheses",
+			rules:    expressions,
+			input:    "1)+2))",
+			repaired: "1+2",
+			errs: []string{
+				"Unexpected ')' at 1:2, expected one of end of input, '*', '+' while parsing S",
+				"Unexpected ')' at 1:5, expected one of end of input, '*', '+'",
+			},
+		},
+		{
+			name:     "several errors",
+			rules:    expressions,
+			input:    "1++2**1+(2*)",
+			repaired: "1+1+2*1*1+(2*1)",
+			errs: []string{
+				"Unexpected '+' at 1:3, expected one of '(', '1', '2' while parsing S > S > S > M > T",
+				"Unexpected '*' at 1:6, expected one of '(', '1', '2' while parsing S > S > M > M > T",
+				"Unexpected ')' at 1:12, expected one of '(', '1', '2' while parsing S > M > T > S > M > T",
+			},
+		},
+		{
+			name:     "empty",
+			rules:    expressions,
+			input:    "",
+			repaired: "1",
+			errs:     []string{"Unexpected end of input at 1:1, expected one of '(', '1', '2' while parsing S > M > T"},
+		},
+		{
+			name:     "without synchronisation",
+			rules:    statements,
+			input:    "x=1;x=))))1;x=1+1;",
+			repaired: "x=1;x=1;x=1+1;",
+			errs:     []string{"Unexpected ')' at 1:7, expected '1' while parsing P > P > St > E"},
+		},
+		{
+			name:     "synchronisation",
+			rules:    statements,
+			sync:     []Terminal{";"},
+			input:    "x=1;x=))))1;x=1+;x=1+1;",
+			repaired: "x=1;x=<E>;x=1+1;x=1+1;",
+			errs: []string{
+				"Unexpected ')' at 1:7, expected '1' while parsing P > P > St",
+				"Unexpected ';' at 1:17, expected '1' while parsing P > P > P > St > E",
+			},
+		},
+		{
+			name:     "synchronisation on a missing statement",
+			rules:    statements,
+			sync:     []Terminal{";"},
+			input:    "x=1;1+1+1+1+1;x=1;",
+			repaired: "x=1;x=<E>;x=1;",
+			errs:     []string{"Unexpected '1' at 1:5, expected one of end of input, 'x' while parsing P > P > St"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			tree, errs := New(g, WithSync(tt.sync...)).ParseRecover(tt.input)
+			if tree == nil {
+				t.Fatalf("ParseRecover() returned no tree, errors %v", errs)
+			}
+			if got := repaired(tree, tt.input); got != tt.repaired {
+				t.Errorf("ParseRecover() repaired %q into %q, want %q\n%s", tt.input, got, tt.repaired, tree)
+			}
+			if tree.Span != (Span{Start: 0, End: len(tt.input)}) {
+				t.Errorf("ParseRecover() root spans %v", tree.Span)
+			}
+			var messages []string
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			if !slices.Equal(messages, tt.errs) {
+				t.Errorf("ParseRecover() errors\n%q\nwant\n%q", messages, tt.errs)
+			}
+		})
+	}
+}
+
+func TestParseTokensRecover(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("Block", Expr{Literal("{"), Ref("Stmts"), Literal("}")}),
+		NewRule("Stmts", Expr{Ref("Stmt"), Ref("Stmts")}),
+		NewRule("Stmts", Expr{}),
+		NewRule("Stmt", Expr{Terminal("ID"), Literal("="), Terminal("NUM"), Literal(";")}),
+		NewRule("Stmt", Expr{Ref("Block")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	lexer, err := NewRegexLexer([]TokenDef{
+		{Kind: "WS", Pattern: `\s+`, Skip: true},
+		{Kind: "ID", Pattern: `[a-z]+`},
+		{Kind: "NUM", Pattern: `[0-9]+`},
+		{Kind: "=", Pattern: `=`},
+		{Kind: ";", Pattern: `;`},
+		{Kind: "{", Pattern: `\{`},
+		{Kind: "}", Pattern: `\}`},
+	})
+	if err != nil {
+		t.Fatalf("NewRegexLexer() unexpected error: %v", err)
+	}
+
+	input := "{ a = 1; b = = 2; { c 3; } d = 4 }"
+	tokens, err := lexer.Tokenize(input)
+	if err != nil {
+		t.Fatalf("Tokenize() unexpected error: %v", err)
+	}
+	tree, errs := New(g, WithSync(";", "}")).ParseTokensRecover(tokens)
+	if tree == nil {
+		t.Fatalf("ParseTokensRecover() returned no tree, errors %v", errs)
+	}
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	expected := []string{
+		"Unexpected '=' at offset 13, expected 'NUM' while parsing Block > Stmts > Stmts > Stmt",
+		"Unexpected '3' at offset 22, expected '=' while parsing Block > Stmts > Stmts > Stmts > Stmt > Block > Stmts > Stmt",
+		"Unexpected '}' at offset 33, expected ';' while parsing Block > Stmts > Stmts > Stmts > Stmts > Stmt",
+	}
+	if !slices.Equal(messages, expected) {
+		t.Errorf("ParseTokensRecover() errors\n%q\nwant\n%q\n%s", messages, expected, tree)
+	}
+	if tree.Span != (Span{Start: 0, End: len(input)}) {
+		t.Errorf("ParseTokensRecover() root spans %v", tree.Span)
+	}
+	// The statements after each error are still parsed
+	var ids []string
+	for _, stmt := range tree.Find("Stmt") {
+		if stmt.Rule == 3 {
+			ids = append(ids, stmt.Children[0].Text(input))
+		}
+	}
+	if !slices.Equal(ids, []string{"a", "b", "c", "d"}) {
+		t.Errorf("ParseTokensRecover() parsed statements %v\n%s", ids, tree)
+	}
+}
+
+func TestParseRecoverConcurrent(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("P", Expr{Ref("St"), Ref("P")}),
+		NewRule("P", Expr{}),
+		NewRule("St", Expr{Literal("x"), Literal("="), Ref("E"), Literal(";")}),
+		NewRule("E", Expr{Ref("E"), Literal("+"), Literal("1")}),
+		NewRule("E", Expr{Literal("1")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	p := New(g, WithSync(";"))
+	inputs := []string{"x=1;", "x=1+;x=1;", "x=))1;x=1+1;", "x=1;1+1;x=1;", "x="}
+	result := func(input string) string {
+		tree, errs := p.ParseRecover(input)
+		return fmt.Sprint(tree, errs)
+	}
+	expected := make([]string, len(inputs))
+	for i, input := range inputs {
+		expected[i] = result(input)
+	}
+
+	var wg sync.WaitGroup
+	for n := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 4 * len(inputs) {
+				i = (i + n) % len(inputs)
+				if got := result(inputs[i]); got != expected[i] {
+					t.Errorf("ParseRecover(%q) = %s while parsing concurrently, want %s", inputs[i], got, expected[i])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
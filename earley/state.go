@@ -2,65 +2,53 @@ package earley
 
 import (
 	"fmt"
+
 	. "github.com/costowell/parsing-fun/common"
 )
 
-type State struct {
-	k              int
-	variable       Variable
-	rule           *Expr
-	position       int
-	originPosition int
+// dottedRule is a rule with a position in it, states refer to them by ID. The
+// dotted rules of a rule have consecutive IDs, so advancing a state increments it.
+type dottedRule struct {
+	// rule is the index of the rule in the grammar, -1 for _P -> S
+	rule     int
+	dot      int
+	variable Variable
+	// lhs is the ID of the variable, -1 for _P
+	lhs  int
+	expr Expr
+	// next is the symbol after the dot, nil if the rule is complete
+	next Symbol
+	// waitsFor is the ID of the variable after the dot, -1 if there is none
+	waitsFor int
 }
 
 const positionMarker = "•"
 
-func (s *State) String() string {
+func (d *dottedRule) String() string {
 	var ruleString string
-	for i, sym := range *s.rule {
-		if i == s.position {
+	for i, sym := range d.expr {
+		if i == d.dot {
 			ruleString += positionMarker
 		}
-		switch s := sym.(type) {
-		case string:
-			ruleString += "'" + s + "'" + " "
-		case RuleRef:
-			ruleString += string(s.Variable) + " "
+		if _, ok := sym.(Literal); ok {
+			ruleString += "'" + sym.String() + "'" + " "
+		} else {
+			ruleString += sym.String() + " "
 		}
 	}
-	if len(*s.rule) == s.position {
+	if len(d.expr) == d.dot {
 		ruleString += positionMarker
 	}
-	return fmt.Sprintf("(%s -> %s, oP:%d, k:%d)", s.variable, ruleString, s.originPosition, s.k)
-}
-
-func (s State) IncrementK() State {
-	return State{
-		k:              s.k + 1,
-		variable:       s.variable,
-		rule:           s.rule,
-		position:       s.position,
-		originPosition: s.originPosition,
-	}
+	return fmt.Sprintf("%s -> %s", d.variable, ruleString)
 }
 
-func (s State) IncrementPosition() State {
-	return State{
-		k:              s.k,
-		variable:       s.variable,
-		rule:           s.rule,
-		position:       s.position + 1,
-		originPosition: s.originPosition,
-	}
-}
-
-func (s *State) NextSym() Symbol {
-	if s.IsComplete() {
-		return nil
-	}
-	return (*s.rule)[s.position]
+// State is a state of an Earley set, a dotted rule and the set it started in
+type State struct {
+	item   int
+	origin int
 }
 
-func (s *State) IsComplete() bool {
-	return s.position >= len(*s.rule)
+// advance returns the state with the dot moved past the next symbol
+func (s State) advance() State {
+	return State{item: s.item + 1, origin: s.origin}
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+func runGenerate(e *env, args []string) int {
+	fs := e.flags("generate", "grammar")
+	n := fs.Int("n", 10, "maximum number of sentences, 0 for every sentence up to the maximum length")
+	length := fs.Int("length", 8, "maximum number of terminals in a sentence")
+	random := fs.Bool("random", false, "print n random sentences instead of the shortest ones")
+	seed := fs.Uint64("seed", 1, "seed of the random sentences")
+	depth := fs.Int("depth", 0, "maximum derivation depth of the random sentences, 0 for the default")
+	target := fs.Int("target", -1, "number of terminals the random sentences target, -1 for depth-bounded sentences")
+	left := fs.Bool("left", false, "print the left parse of each random sentence after a tab")
+	if status, ok := parseFlags(fs, args, 1); !ok {
+		return status
+	}
+
+	g, err := e.loadGrammar(fs.Arg(0))
+	if err != nil {
+		e.errorf("%s", err.Error())
+		return exitError
+	}
+
+	// Sentences of token kinds are printed in the format of parse -tokens
+	sep := ""
+	if len(g.Kinds()) > 0 {
+		sep = " "
+	}
+	if !*random {
+		for _, s := range sentences(g, *n, *length) {
+			fmt.Fprintln(e.stdout, strings.Join(s, sep))
+		}
+		return exitOK
+	}
+
+	opts := []GeneratorOption{WithSeed(*seed)}
+	if *left {
+		opts = append(opts, WithLeftParse())
+	}
+	if *depth > 0 {
+		opts = append(opts, WithMaxDepth(*depth))
+	}
+	if *target >= 0 {
+		opts = append(opts, WithLength(*target))
+	}
+	gen, err := NewGenerator(g, opts...)
+	if err != nil {
+		e.errorf("%s", err.Error())
+		return exitError
+	}
+	for range *n {
+		s := gen.Generate()
+		if *left {
+			fmt.Fprintf(e.stdout, "%s\t%s", strings.Join(s.Words, sep), ruleNumbers(s.LeftParse))
+		} else {
+			fmt.Fprintln(e.stdout, strings.Join(s.Words, sep))
+		}
+	}
+	return exitOK
+}
+
+// sentences returns the n shortest sentences of g of at most maxLen terminals,
+// ordered by length and then lexicographically, every one of them if n is 0
+func sentences(g *Grammar, n, maxLen int) [][]string {
+	table := make(map[Variable][]map[string][]string)
+	var res [][]string
+	// Grow the table one length at a time until there are enough sentences
+	for l := 0; l <= maxLen && (n == 0 || len(res) < n); l++ {
+		grow(g, table, l)
+		found := slices.Collect(maps.Values(table[g.StartVariable()][l]))
+		slices.SortFunc(found, slices.Compare[[]string])
+		res = append(res, found...)
+	}
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// grow adds to table, holding by number of terminals the strings each variable
+// derives, the strings of l terminals given those of fewer terminals
+func grow(g *Grammar, table map[Variable][]map[string][]string, l int) {
+	for _, v := range g.Variables.Data {
+		table[v] = append(table[v], make(map[string][]string))
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range g.Rules {
+			for _, s := range concatenations(rule.Expr, table, l) {
+				key := strings.Join(s, "\x00")
+				if _, ok := table[rule.Variable][l][key]; !ok {
+					table[rule.Variable][l][key] = s
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// concatenations returns the strings of l terminals expr derives using the
+// strings found so far for its variables
+func concatenations(expr Expr, table map[Variable][]map[string][]string, l int) [][]string {
+	var res [][]string
+	var extend func(i, left int, prefix []string)
+	extend = func(i, left int, prefix []string) {
+		if i == len(expr) {
+			if left == 0 {
+				res = append(res, prefix)
+			}
+			return
+		}
+		switch v := expr[i].(type) {
+		case RuleRef:
+			for k := 0; k <= left; k++ {
+				for _, s := range table[v.Variable][k] {
+					extend(i+1, left-k, append(slices.Clip(prefix), s...))
+				}
+			}
+		case CharClass:
+			// A class stands for its smallest printable character
+			if r, ok := v.Example(); ok && left > 0 {
+				extend(i+1, left-1, append(slices.Clip(prefix), string(r)))
+			}
+		default:
+			if left > 0 {
+				extend(i+1, left-1, append(slices.Clip(prefix), v.String()))
+			}
+		}
+	}
+	extend(0, l, nil)
+	return res
+}
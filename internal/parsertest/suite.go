@@ -0,0 +1,179 @@
+// Package parsertest holds a test suite shared by every parser implementing common.Parser
+package parsertest
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+// Case is a grammar with inputs it should accept and reject
+type Case struct {
+	Name   string
+	Rules  []Rule
+	Accept []string
+	Reject []string
+}
+
+// Cases is the suite every parser is run against
+var Cases = []Case{
+	{
+		Name: "operator precedence",
+		Rules: []Rule{
+			NewRule("S", Expr{Ref("S"), Literal("+"), Ref("M")}),
+			NewRule("S", Expr{Ref("M")}),
+			NewRule("M", Expr{Ref("M"), Literal("*"), Ref("T")}),
+			NewRule("M", Expr{Ref("T")}),
+			NewRule("T", Expr{Literal("1")}),
+			NewRule("T", Expr{Literal("2")}),
+			NewRule("T", Expr{Literal("3")}),
+			NewRule("T", Expr{Literal("4")}),
+		},
+		Accept: []string{"1", "1*2", "2+3*4", "2*3+4*2*3+4+2*3+4*2*3+4+2*3+4+2*3+4*2*3+4+2*3+4*2*3+4+2*3+4"},
+		Reject: []string{"", "2*3+", "+", "12"},
+	},
+	{
+		Name: "right recursive expressions",
+		Rules: []Rule{
+			NewRule("E", Expr{Ref("T"), Ref("E'")}),
+			NewRule("E'", Expr{Literal("+"), Ref("T"), Ref("E'")}),
+			NewRule("E'", Expr{}),
+			NewRule("T", Expr{Ref("F"), Ref("T'")}),
+			NewRule("T'", Expr{Literal("*"), Ref("F"), Ref("T'")}),
+			NewRule("T'", Expr{}),
+			NewRule("F", Expr{Literal("("), Ref("E"), Literal(")")}),
+			NewRule("F", Expr{Literal("x")}),
+		},
+		Accept: []string{"x", "x+x", "x*(x+x)", "(x)", "((x*x)+x)*x"},
+		Reject: []string{"", "x+", "()", "(x", "x)"},
+	},
+	{
+		Name: "balanced parentheses",
+		Rules: []Rule{
+			NewRule("S", Expr{Literal("("), Ref("S"), Literal(")"), Ref("S")}),
+			NewRule("S", Expr{}),
+		},
+		Accept: []string{"", "()", "(())", "()()", "(()())()"},
+		Reject: []string{"(", ")", "())", "(()"},
+	},
+	{
+		Name: "anbn",
+		Rules: []Rule{
+			NewRule("S", Expr{Literal("a"), Ref("S"), Literal("b")}),
+			NewRule("S", Expr{Literal("a"), Literal("b")}),
+		},
+		Accept: []string{"ab", "aabb", "aaaabbbb"},
+		Reject: []string{"", "a", "ba", "aab", "abab"},
+	},
+	{
+		Name: "ambiguous sums",
+		Rules: []Rule{
+			NewRule("E", Expr{Ref("E"), Literal("+"), Ref("E")}),
+			NewRule("E", Expr{Literal("1")}),
+		},
+		Accept: []string{"1", "1+1", "1+1+1+1"},
+		Reject: []string{"", "+", "1+", "11"},
+	},
+	{
+		Name: "palindromes",
+		Rules: []Rule{
+			NewRule("S", Expr{Literal("a"), Ref("S"), Literal("a")}),
+			NewRule("S", Expr{Literal("b"), Ref("S"), Literal("b")}),
+			NewRule("S", Expr{Literal("a")}),
+			NewRule("S", Expr{Literal("b")}),
+		},
+		Accept: []string{"a", "aba", "ababa", "abbba"},
+		Reject: []string{"", "ab", "abab", "abba"},
+	},
+}
+
+// Run runs the suite against the parsers built by newParser, grammars it fails
+// to build a parser for are skipped
+func Run(t *testing.T, newParser func(g *Grammar) (Parser, error)) {
+	for _, tc := range Cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			g, err := NewGrammar(tc.Rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			parser, err := newParser(g)
+			if err != nil {
+				t.Skipf("grammar not supported: %v", err)
+			}
+			for _, input := range tc.Accept {
+				leftParse, err := parser.Parse(input)
+				if err != nil {
+					t.Errorf("Parse(%q) unexpected error: %v", input, err)
+					continue
+				}
+				str, err := g.EvalLeftParse(leftParse)
+				if err != nil {
+					t.Errorf("EvalLeftParse(%v) unexpected error: %v", leftParse, err)
+					continue
+				}
+				if str != input {
+					t.Errorf("EvalLeftParse() invalid left parse, expected %q, got %q", input, str)
+				}
+			}
+			for _, input := range tc.Reject {
+				if _, err := parser.Parse(input); err == nil {
+					t.Errorf("Parse(%q) expected error, got none", input)
+				}
+			}
+		})
+	}
+}
+
+// RunConcurrent runs the suite with a single parser for each grammar shared by
+// many goroutines, checking every parse gives the result of a parse on its own.
+// Run it with -race to find state shared between parses.
+func RunConcurrent(t *testing.T, newParser func(g *Grammar) (Parser, error)) {
+	const goroutines, rounds = 8, 4
+	for _, tc := range Cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			g, err := NewGrammar(tc.Rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			parser, err := newParser(g)
+			if err != nil {
+				t.Skipf("grammar not supported: %v", err)
+			}
+			inputs := append(slices.Clone(tc.Accept), tc.Reject...)
+			expected := make([]string, len(inputs))
+			for i, input := range inputs {
+				expected[i] = result(parser, input)
+			}
+
+			var wg sync.WaitGroup
+			for n := range goroutines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for r := range rounds {
+						// Goroutines start at different inputs so different parses overlap
+						for i := range inputs {
+							j := (i + n + r) % len(inputs)
+							if got := result(parser, inputs[j]); got != expected[j] {
+								t.Errorf("Parse(%q) = %s while parsing concurrently, want %s", inputs[j], got, expected[j])
+							}
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// result returns the left parse of input or its error as a string
+func result(parser Parser, input string) string {
+	leftParse, err := parser.Parse(input)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprint(leftParse)
+}
@@ -0,0 +1,197 @@
+package ll1
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+// Conflict is a cell of the LL(1) table claimed by several rules
+type Conflict struct {
+	Variable  Variable
+	Lookahead Terminal
+	Rules     []int
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s on %s: rules %v", c.Variable, DescribeTerminal(c.Lookahead), c.Rules)
+}
+
+// ConflictError reports every conflict of a grammar that is not LL(1)
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	conflicts := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		conflicts[i] = c.String()
+	}
+	return "Grammar is not LL(1): " + strings.Join(conflicts, "; ")
+}
+
+// Table is an LL(1) predictive parsing table, mapping a variable and a lookahead
+// terminal to the rule to expand the variable with
+type Table map[Variable]map[Terminal]int
+
+// BuildTable computes the LL(1) table of gram, or a *ConflictError listing every
+// cell claimed by more than one rule
+func BuildTable(gram *Grammar) (Table, error) {
+	sets := gram.FirstFollow()
+	cells := make(map[Variable]map[Terminal]*OrderedSet[int])
+	var order []Conflict
+
+	add := func(v Variable, t Terminal, rule int) {
+		if _, ok := cells[v]; !ok {
+			cells[v] = make(map[Terminal]*OrderedSet[int])
+		}
+		if _, ok := cells[v][t]; !ok {
+			rules := NewOrderedSet[int]()
+			cells[v][t] = &rules
+			order = append(order, Conflict{Variable: v, Lookahead: t})
+		}
+		cells[v][t].Insert(rule)
+	}
+
+	for i, rule := range gram.Rules {
+		first, nullable := sets.FirstOf(rule.Expr)
+		for _, t := range first.Data {
+			add(rule.Variable, t, i)
+		}
+		if nullable {
+			for _, t := range sets.Follow[rule.Variable].Data {
+				add(rule.Variable, t, i)
+			}
+		}
+	}
+
+	table := make(Table)
+	var conflicts []Conflict
+	for _, cell := range order {
+		rules := cells[cell.Variable][cell.Lookahead].Data
+		if len(rules) > 1 {
+			cell.Rules = rules
+			conflicts = append(conflicts, cell)
+			continue
+		}
+		if _, ok := table[cell.Variable]; !ok {
+			table[cell.Variable] = make(map[Terminal]int)
+		}
+		table[cell.Variable][cell.Lookahead] = rules[0]
+	}
+	if len(conflicts) > 0 {
+		return nil, &ConflictError{Conflicts: conflicts}
+	}
+	return table, nil
+}
+
+type realParser struct {
+	gram  *Grammar
+	table Table
+	lexer Lexer
+}
+
+// stackItem is a symbol still to be derived, along with where its subtree goes
+type stackItem struct {
+	sym    Symbol
+	parent *ParseTree
+	index  int
+}
+
+func (p *realParser) Parse(input string) ([]int, error) {
+	tree, err := p.ParseTree(input)
+	if err != nil {
+		return nil, err
+	}
+	return tree.LeftParse(), nil
+}
+
+func (p *realParser) ParseTokens(tokens []Token) ([]int, error) {
+	tree, err := p.ParseTokensTree(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return tree.LeftParse(), nil
+}
+
+func (p *realParser) ParseTree(input string) (*ParseTree, error) {
+	tokens, err := p.lexer.Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	return p.ParseTokensTree(tokens)
+}
+
+func (p *realParser) ParseTokensTree(tokens []Token) (*ParseTree, error) {
+	root := &ParseTree{}
+	stack := []stackItem{{sym: Ref(p.gram.StartVariable()), parent: root}}
+	root.Children = make([]*ParseTree, 1)
+
+	i := 0
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		lookahead := EndOfInput
+		if i < len(tokens) {
+			lookahead = tokens[i].Kind
+		}
+
+		if t, ok := TerminalOf(item.sym); ok {
+			if t != lookahead {
+				return nil, UnexpectedToken(tokens, i, []Terminal{t})
+			}
+			item.parent.Children[item.index] = NewLeaf(item.sym, tokens[i].Span)
+			i++
+			continue
+		}
+
+		v := item.sym.(RuleRef).Variable
+		rule, ok := p.table[v][lookahead]
+		if !ok {
+			return nil, UnexpectedToken(tokens, i, slices.Sorted(maps.Keys(p.table[v])))
+		}
+		expr := p.gram.Rules[rule].Expr
+		node := &ParseTree{
+			Rule:     rule,
+			Variable: v,
+			Children: make([]*ParseTree, len(expr)),
+		}
+		item.parent.Children[item.index] = node
+		for j := len(expr) - 1; j >= 0; j-- {
+			stack = append(stack, stackItem{sym: expr[j], parent: node, index: j})
+		}
+	}
+	if i < len(tokens) {
+		return nil, UnexpectedToken(tokens, i, []Terminal{EndOfInput})
+	}
+
+	tree := root.Children[0]
+	if len(tokens) > 0 {
+		tree.RecomputeSpans(tokens[0].Span.Start)
+	} else {
+		tree.RecomputeSpans(0)
+	}
+	return tree, nil
+}
+
+// New creates a table-driven LL(1) parser for gram, or returns a *ConflictError
+// if gram is not LL(1). Raw input is split into the grammar's terminals by
+// longest match before parsing.
+func New(gram *Grammar) (TreeParser, error) {
+	if classes := gram.Classes(); len(classes) > 0 {
+		return nil, fmt.Errorf("Character class '%s' is not supported, use the Earley or CYK parser", classes[0])
+	}
+	table, err := BuildTable(gram)
+	if err != nil {
+		return nil, err
+	}
+	return &realParser{
+		gram:  gram,
+		table: table,
+		lexer: NewLiteralLexer(gram),
+	}, nil
+}
@@ -0,0 +1,173 @@
+package ll1
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	. "github.com/costowell/parsing-fun/common"
+	"github.com/costowell/parsing-fun/internal/parsertest"
+)
+
+func TestSuite(t *testing.T) {
+	parsertest.Run(t, func(g *Grammar) (Parser, error) {
+		return New(g)
+	})
+}
+
+func TestConcurrent(t *testing.T) {
+	parsertest.RunConcurrent(t, func(g *Grammar) (Parser, error) {
+		return New(g)
+	})
+}
+
+func TestConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     []Rule
+		conflicts []Conflict
+	}{
+		{
+			name: "left recursion",
+			rules: []Rule{
+				NewRule("S", Expr{Ref("S"), Literal("+"), Literal("x")}),
+				NewRule("S", Expr{Literal("x")}),
+			},
+			conflicts: []Conflict{
+				{Variable: "S", Lookahead: "x", Rules: []int{0, 1}},
+			},
+		},
+		{
+			name: "common prefix and nullable",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Literal("b")}),
+				NewRule("S", Expr{Literal("a"), Literal("c")}),
+				NewRule("S", Expr{Ref("A"), Literal("d")}),
+				NewRule("A", Expr{Literal("d")}),
+				NewRule("A", Expr{}),
+			},
+			conflicts: []Conflict{
+				{Variable: "S", Lookahead: "a", Rules: []int{0, 1}},
+				{Variable: "S", Lookahead: "d", Rules: []int{2}},
+				{Variable: "A", Lookahead: "d", Rules: []int{3, 4}},
+			},
+		},
+		{
+			name: "LL(1)",
+			rules: []Rule{
+				NewRule("S", Expr{Literal("a"), Ref("S")}),
+				NewRule("S", Expr{}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			_, err = New(g)
+			var conflictErr *ConflictError
+			if !errors.As(err, &conflictErr) {
+				if len(tt.conflicts) > 0 {
+					t.Fatalf("New() error = %v, want *ConflictError", err)
+				}
+				return
+			}
+			var expected []Conflict
+			for _, c := range tt.conflicts {
+				if len(c.Rules) > 1 {
+					expected = append(expected, c)
+				}
+			}
+			if len(conflictErr.Conflicts) != len(expected) {
+				t.Fatalf("New() conflicts = %v, want %v", conflictErr.Conflicts, expected)
+			}
+			for i, c := range conflictErr.Conflicts {
+				if c.Variable != expected[i].Variable || c.Lookahead != expected[i].Lookahead || !slices.Equal(c.Rules, expected[i].Rules) {
+					t.Errorf("New() conflict %d = %v, want %v", i, c, expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("S", Expr{Literal("("), Ref("S"), Literal(")"), Ref("S")}),
+		NewRule("S", Expr{}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	parser, err := New(g)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(()", "Unexpected end of input, expected ')'"},
+		{"())", "Unexpected ')' at offset 2, expected end of input"},
+		{"(x)", "Unexpected character 'x' at 1:2"},
+	}
+	for _, tt := range tests {
+		_, err := parser.Parse(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.input, err, tt.expected)
+		}
+	}
+}
+
+func TestRemovedLeftRecursion(t *testing.T) {
+	g, err := NewGrammar([]Rule{
+		NewRule("S", Expr{Ref("S"), Literal("+"), Ref("M")}),
+		NewRule("S", Expr{Ref("M")}),
+		NewRule("M", Expr{Ref("M"), Literal("*"), Ref("T")}),
+		NewRule("M", Expr{Ref("T")}),
+		NewRule("T", Expr{Literal("1")}),
+		NewRule("T", Expr{Literal("2")}),
+		NewRule("T", Expr{Literal("3")}),
+	})
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	if _, err := New(g); err == nil {
+		t.Fatalf("New() expected left recursive grammar to be rejected")
+	}
+	h, err := g.RemoveLeftRecursion()
+	if err != nil {
+		t.Fatalf("RemoveLeftRecursion() unexpected error: %v", err)
+	}
+	parser, err := New(h)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		input     string
+		leftParse []int
+	}{
+		{"1", []int{1, 3, 4}},
+		{"1+2*3", []int{0, 1, 3, 4, 2, 3, 5, 6}},
+		{"1*2+3+1", []int{0, 0, 1, 2, 3, 4, 5, 3, 6, 3, 4}},
+	}
+	for _, tt := range tests {
+		tree, err := parser.ParseTree(tt.input)
+		if err != nil {
+			t.Fatalf("ParseTree(%q) unexpected error: %v", tt.input, err)
+		}
+		folded, err := h.FoldTo(tree, g)
+		if err != nil {
+			t.Fatalf("FoldTo() unexpected error: %v", err)
+		}
+		if leftParse := folded.LeftParse(); !slices.Equal(leftParse, tt.leftParse) {
+			t.Errorf("ParseTree(%q) folds to %v, want %v", tt.input, leftParse, tt.leftParse)
+		}
+		if folded.Span != (Span{Start: 0, End: len(tt.input)}) {
+			t.Errorf("ParseTree(%q) folds to span %v", tt.input, folded.Span)
+		}
+	}
+}
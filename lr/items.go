@@ -0,0 +1,250 @@
+package lr
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+// acceptRule is the rule number of the augmented rule S' -> S
+const acceptRule = -1
+
+// Item is a rule with a dot marking how much of it has been recognised, along
+// with the lookahead terminal it may be reduced on (EndOfInput for LR(0) items)
+type Item struct {
+	// Rule is the index of the rule in Grammar.Rules, -1 for the augmented start rule
+	Rule      int
+	Dot       int
+	Lookahead Terminal
+	// desc is the item written out with its rule, for printing
+	desc     string
+	complete bool
+}
+
+func (it Item) String() string {
+	return it.desc
+}
+
+// item is the comparable form of an Item used while building the automaton
+type item struct {
+	rule      int
+	dot       int
+	lookahead Terminal
+}
+
+func compareItems(a, b item) int {
+	return cmp.Or(cmp.Compare(a.rule, b.rule), cmp.Compare(a.dot, b.dot), cmp.Compare(a.lookahead, b.lookahead))
+}
+
+// kernelKey returns a key identifying a sorted kernel, quoting lookaheads so
+// that distinct kernels never share a key
+func kernelKey(kernel []item) string {
+	var sb strings.Builder
+	for _, it := range kernel {
+		sb.WriteString(strconv.Itoa(it.rule))
+		sb.WriteByte('.')
+		sb.WriteString(strconv.Itoa(it.dot))
+		sb.WriteString(strconv.Quote(string(it.lookahead)))
+	}
+	return sb.String()
+}
+
+// state is a set of items of the automaton along with its transitions
+type state struct {
+	// kernel holds the sorted items the state was reached with
+	kernel []item
+	items  []item
+	next   map[Symbol]int
+}
+
+// automaton is the item-set automaton of a grammar augmented with S' -> S
+type automaton struct {
+	gram   *Grammar
+	sets   *FirstFollow
+	rules  map[Variable][]int
+	states []*state
+	// lookaheads tells whether items carry a lookahead (LR(1) and LALR(1))
+	lookaheads bool
+}
+
+// symbolKey normalises Literals to Terminals so terminals compare equal whatever their type
+func symbolKey(sym Symbol) Symbol {
+	if t, ok := TerminalOf(sym); ok {
+		return t
+	}
+	return sym
+}
+
+func (a *automaton) expr(rule int) Expr {
+	if rule == acceptRule {
+		return Expr{Ref(a.gram.StartVariable())}
+	}
+	return a.gram.Rules[rule].Expr
+}
+
+func (a *automaton) variable(rule int) Variable {
+	if rule == acceptRule {
+		return a.gram.StartVariable() + "'"
+	}
+	return a.gram.Rules[rule].Variable
+}
+
+// export returns the printable form of an item
+func (a *automaton) export(it item) Item {
+	expr := a.expr(it.rule)
+	syms := make([]string, 0, len(expr)+1)
+	for i, sym := range expr {
+		if i == it.dot {
+			syms = append(syms, "•")
+		}
+		if t, ok := TerminalOf(sym); ok {
+			syms = append(syms, "'"+t.String()+"'")
+		} else {
+			syms = append(syms, sym.(RuleRef).Variable.String())
+		}
+	}
+	if it.dot == len(expr) {
+		syms = append(syms, "•")
+	}
+	desc := fmt.Sprintf("%s -> %s", a.variable(it.rule), strings.Join(syms, " "))
+	if a.lookaheads {
+		desc += ", " + DescribeTerminal(it.lookahead)
+	}
+	return Item{Rule: it.rule, Dot: it.dot, Lookahead: it.lookahead, desc: desc, complete: it.dot == len(expr)}
+}
+
+// closure adds to kernel the items predicted by each item with a variable after its dot
+func (a *automaton) closure(kernel []item) []item {
+	items := NewOrderedSet[item]()
+	for _, it := range kernel {
+		items.Insert(it)
+	}
+	for i := 0; i < len(items.Data); i++ {
+		it := items.Data[i]
+		expr := a.expr(it.rule)
+		if it.dot >= len(expr) {
+			continue
+		}
+		ref, ok := expr[it.dot].(RuleRef)
+		if !ok {
+			continue
+		}
+		lookaheads := []Terminal{EndOfInput}
+		if a.lookaheads {
+			rest := append(slices.Clone(expr[it.dot+1:]), it.lookahead)
+			first, _ := a.sets.FirstOf(rest)
+			lookaheads = first.Data
+		}
+		for _, rule := range a.rules[ref.Variable] {
+			for _, t := range lookaheads {
+				items.Insert(item{rule: rule, dot: 0, lookahead: t})
+			}
+		}
+	}
+	return items.Data
+}
+
+// build computes the collection of item sets reachable from S' -> • S
+func (a *automaton) build() {
+	index := make(map[string]int)
+	add := func(kernel []item) int {
+		slices.SortFunc(kernel, compareItems)
+		key := kernelKey(kernel)
+		if i, ok := index[key]; ok {
+			return i
+		}
+		index[key] = len(a.states)
+		a.states = append(a.states, &state{
+			kernel: kernel,
+			items:  a.closure(kernel),
+			next:   make(map[Symbol]int),
+		})
+		return len(a.states) - 1
+	}
+
+	add([]item{{rule: acceptRule, dot: 0, lookahead: EndOfInput}})
+	for i := 0; i < len(a.states); i++ {
+		s := a.states[i]
+		var order []Symbol
+		kernels := make(map[Symbol][]item)
+		for _, it := range s.items {
+			expr := a.expr(it.rule)
+			if it.dot >= len(expr) {
+				continue
+			}
+			sym := symbolKey(expr[it.dot])
+			if _, ok := kernels[sym]; !ok {
+				order = append(order, sym)
+			}
+			kernels[sym] = append(kernels[sym], item{rule: it.rule, dot: it.dot + 1, lookahead: it.lookahead})
+		}
+		for _, sym := range order {
+			s.next[sym] = add(kernels[sym])
+		}
+	}
+}
+
+// mergeCores merges the states sharing the same items once lookaheads are
+// ignored, turning the canonical LR(1) collection into the LALR(1) one
+func (a *automaton) mergeCores() {
+	coreOf := func(kernel []item) string {
+		core := NewOrderedSet[item]()
+		for _, it := range kernel {
+			core.Insert(item{rule: it.rule, dot: it.dot})
+		}
+		return kernelKey(core.Data)
+	}
+
+	index := make(map[string]int)
+	mapping := make([]int, len(a.states))
+	var merged []*state
+	for i, s := range a.states {
+		key := coreOf(s.kernel)
+		j, ok := index[key]
+		if !ok {
+			j = len(merged)
+			index[key] = j
+			merged = append(merged, &state{kernel: s.kernel, items: s.items, next: s.next})
+			mapping[i] = j
+			continue
+		}
+		mapping[i] = j
+		items := NewOrderedSet[item]()
+		for _, it := range merged[j].items {
+			items.Insert(it)
+		}
+		for _, it := range s.items {
+			items.Insert(it)
+		}
+		merged[j].items = items.Data
+	}
+	for _, s := range merged {
+		next := make(map[Symbol]int, len(s.next))
+		for sym, target := range s.next {
+			next[sym] = mapping[target]
+		}
+		s.next = next
+	}
+	a.states = merged
+}
+
+func newAutomaton(gram *Grammar, kind Kind) *automaton {
+	a := &automaton{
+		gram:       gram,
+		sets:       gram.FirstFollow(),
+		rules:      make(map[Variable][]int),
+		lookaheads: kind == LALR1 || kind == LR1,
+	}
+	for i, rule := range gram.Rules {
+		a.rules[rule.Variable] = append(a.rules[rule.Variable], i)
+	}
+	a.build()
+	if kind == LALR1 {
+		a.mergeCores()
+	}
+	return a
+}
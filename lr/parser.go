@@ -0,0 +1,304 @@
+package lr
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+// Kind selects how the item-set automaton and its lookaheads are computed
+type Kind int
+
+const (
+	// LR0 reduces complete items whatever the lookahead
+	LR0 Kind = iota
+	// SLR1 reduces complete items on the FOLLOW set of their variable
+	SLR1
+	// LALR1 merges the LR(1) states sharing the same core
+	LALR1
+	// LR1 uses the canonical LR(1) collection
+	LR1
+)
+
+func (k Kind) String() string {
+	switch k {
+	case LR0:
+		return "LR(0)"
+	case SLR1:
+		return "SLR(1)"
+	case LALR1:
+		return "LALR(1)"
+	case LR1:
+		return "LR(1)"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+type actionKind int
+
+const (
+	shift actionKind = iota
+	reduce
+	accept
+)
+
+// action is an entry of the ACTION table, target is a state for shifts and a
+// rule for reductions
+type action struct {
+	kind   actionKind
+	target int
+}
+
+// Conflict is a cell of the ACTION table claimed by several actions, along with
+// the items asking for them
+type Conflict struct {
+	State     int
+	Lookahead Terminal
+	Items     []Item
+}
+
+// IsShiftReduce returns whether one of the conflicting actions is a shift
+func (c Conflict) IsShiftReduce() bool {
+	for _, it := range c.Items {
+		if !it.complete {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAcceptReduce returns whether one of the conflicting actions is the accept
+// of the augmented start rule, a reduction being possible once the start
+// variable is recognised as it appears on the right-hand side of a rule
+func (c Conflict) IsAcceptReduce() bool {
+	for _, it := range c.Items {
+		if it.complete && it.Rule == acceptRule {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Conflict) String() string {
+	kind := "reduce/reduce"
+	if c.IsShiftReduce() {
+		kind = "shift/reduce"
+	} else if c.IsAcceptReduce() {
+		kind = "accept/reduce"
+	}
+	items := make([]string, len(c.Items))
+	for i, it := range c.Items {
+		items[i] = "[" + it.String() + "]"
+	}
+	return fmt.Sprintf("%s conflict in state %d on %s: %s", kind, c.State, DescribeTerminal(c.Lookahead), strings.Join(items, " "))
+}
+
+// ConflictError reports every conflict of a grammar outside the requested class
+type ConflictError struct {
+	Kind      Kind
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	conflicts := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		conflicts[i] = c.String()
+	}
+	return fmt.Sprintf("Grammar is not %s: %s", e.Kind, strings.Join(conflicts, "; "))
+}
+
+type realParser struct {
+	gram   *Grammar
+	action []map[Terminal]action
+	goTo   []map[Variable]int
+	lexer  Lexer
+}
+
+// buildTables fills the ACTION and GOTO tables from the automaton, collecting
+// the cells claimed by more than one action
+func (p *realParser) buildTables(a *automaton, kind Kind) []Conflict {
+	terminals := append(slices.Clone(p.gram.Terminals.Data), EndOfInput)
+	sets := a.sets
+
+	var conflicts []Conflict
+	p.action = make([]map[Terminal]action, len(a.states))
+	p.goTo = make([]map[Variable]int, len(a.states))
+	for i, s := range a.states {
+		p.action[i] = make(map[Terminal]action)
+		p.goTo[i] = make(map[Variable]int)
+		for sym, target := range s.next {
+			if ref, ok := sym.(RuleRef); ok {
+				p.goTo[i][ref.Variable] = target
+			}
+		}
+
+		var order []Terminal
+		cells := make(map[Terminal][]item)
+		actions := make(map[Terminal]*OrderedSet[action])
+		add := func(t Terminal, act action, it item) {
+			if _, ok := actions[t]; !ok {
+				set := NewOrderedSet[action]()
+				actions[t] = &set
+				order = append(order, t)
+			}
+			actions[t].Insert(act)
+			cells[t] = append(cells[t], it)
+		}
+
+		for _, it := range s.items {
+			expr := a.expr(it.rule)
+			if it.dot < len(expr) {
+				if t, ok := TerminalOf(expr[it.dot]); ok {
+					add(t, action{kind: shift, target: s.next[t]}, it)
+				}
+				continue
+			}
+			if it.rule == acceptRule {
+				add(EndOfInput, action{kind: accept}, it)
+				continue
+			}
+			switch kind {
+			case LR0:
+				for _, t := range terminals {
+					add(t, action{kind: reduce, target: it.rule}, it)
+				}
+			case SLR1:
+				for _, t := range sets.Follow[a.variable(it.rule)].Data {
+					add(t, action{kind: reduce, target: it.rule}, it)
+				}
+			default:
+				add(it.lookahead, action{kind: reduce, target: it.rule}, it)
+			}
+		}
+
+		for _, t := range order {
+			if len(actions[t].Data) == 1 {
+				p.action[i][t] = actions[t].Data[0]
+				continue
+			}
+			c := Conflict{State: i, Lookahead: t}
+			for _, it := range cells[t] {
+				c.Items = append(c.Items, a.export(it))
+			}
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts
+}
+
+func (p *realParser) Parse(input string) ([]int, error) {
+	tree, err := p.ParseTree(input)
+	if err != nil {
+		return nil, err
+	}
+	return tree.LeftParse(), nil
+}
+
+func (p *realParser) ParseTokens(tokens []Token) ([]int, error) {
+	tree, err := p.ParseTokensTree(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return tree.LeftParse(), nil
+}
+
+func (p *realParser) ParseTree(input string) (*ParseTree, error) {
+	tokens, err := p.lexer.Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	return p.ParseTokensTree(tokens)
+}
+
+func (p *realParser) ParseTokensTree(tokens []Token) (*ParseTree, error) {
+	tree, _, err := p.parse(tokens)
+	return tree, err
+}
+
+func (p *realParser) ParseRight(input string) ([]int, error) {
+	tokens, err := p.lexer.Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	return p.ParseTokensRight(tokens)
+}
+
+func (p *realParser) ParseTokensRight(tokens []Token) ([]int, error) {
+	_, rightParse, err := p.parse(tokens)
+	return rightParse, err
+}
+
+// parse runs the shift-reduce loop, returning the parse tree and the rules in
+// the order they were reduced
+func (p *realParser) parse(tokens []Token) (*ParseTree, []int, error) {
+	states := []int{0}
+	var trees []*ParseTree
+	rightParse := make([]int, 0)
+
+	i := 0
+	for {
+		lookahead := EndOfInput
+		if i < len(tokens) {
+			lookahead = tokens[i].Kind
+		}
+		top := states[len(states)-1]
+		act, ok := p.action[top][lookahead]
+		if !ok {
+			return nil, nil, UnexpectedToken(tokens, i, slices.Sorted(maps.Keys(p.action[top])))
+		}
+
+		switch act.kind {
+		case shift:
+			trees = append(trees, NewLeaf(lookahead, tokens[i].Span))
+			states = append(states, act.target)
+			i++
+		case reduce:
+			rule := p.gram.Rules[act.target]
+			n := len(rule.Expr)
+			node := &ParseTree{
+				Rule:     act.target,
+				Variable: rule.Variable,
+				Children: slices.Clone(trees[len(trees)-n:]),
+			}
+			// Leaves were shifted by token kind, they hold the symbol of the rule like
+			// the trees of the other parsers
+			for j, child := range node.Children {
+				if child.IsLeaf() {
+					child.Terminal = rule.Expr[j]
+				}
+			}
+			trees = append(trees[:len(trees)-n], node)
+			states = states[:len(states)-n]
+			states = append(states, p.goTo[states[len(states)-1]][rule.Variable])
+			rightParse = append(rightParse, act.target)
+		case accept:
+			tree := trees[0]
+			if len(tokens) > 0 {
+				tree.RecomputeSpans(tokens[0].Span.Start)
+			} else {
+				tree.RecomputeSpans(0)
+			}
+			return tree, rightParse, nil
+		}
+	}
+}
+
+// New creates a table-driven shift-reduce parser of the given kind for gram, or
+// returns a *ConflictError if gram is not in that class. Raw input is split into
+// the grammar's terminals by longest match before parsing.
+func New(gram *Grammar, kind Kind) (RightParser, error) {
+	if classes := gram.Classes(); len(classes) > 0 {
+		return nil, fmt.Errorf("Character class '%s' is not supported, use the Earley or CYK parser", classes[0])
+	}
+	p := &realParser{
+		gram:  gram,
+		lexer: NewLiteralLexer(gram),
+	}
+	if conflicts := p.buildTables(newAutomaton(gram, kind), kind); len(conflicts) > 0 {
+		return nil, &ConflictError{Kind: kind, Conflicts: conflicts}
+	}
+	return p, nil
+}
@@ -0,0 +1,272 @@
+package lr
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	. "github.com/costowell/parsing-fun/common"
+	"github.com/costowell/parsing-fun/internal/parsertest"
+)
+
+func TestSuite(t *testing.T) {
+	for _, kind := range []Kind{LR0, SLR1, LALR1, LR1} {
+		t.Run(kind.String(), func(t *testing.T) {
+			parsertest.Run(t, func(g *Grammar) (Parser, error) {
+				return New(g, kind)
+			})
+		})
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	for _, kind := range []Kind{LR0, SLR1, LALR1, LR1} {
+		t.Run(kind.String(), func(t *testing.T) {
+			parsertest.RunConcurrent(t, func(g *Grammar) (Parser, error) {
+				return New(g, kind)
+			})
+		})
+	}
+}
+
+var (
+	// prefix needs a lookahead to tell S -> a from S -> a b
+	prefix = []Rule{
+		NewRule("S", Expr{Literal("a")}),
+		NewRule("S", Expr{Literal("a"), Literal("b")}),
+	}
+	// assignment is the classic grammar that is LALR(1) but not SLR(1)
+	assignment = []Rule{
+		NewRule("S", Expr{Ref("L"), Literal("="), Ref("R")}),
+		NewRule("S", Expr{Ref("R")}),
+		NewRule("L", Expr{Literal("*"), Ref("R")}),
+		NewRule("L", Expr{Literal("x")}),
+		NewRule("R", Expr{Ref("L")}),
+	}
+	// merged is LR(1) but merging the cores of its states confuses A and B
+	merged = []Rule{
+		NewRule("S", Expr{Literal("a"), Ref("A"), Literal("d")}),
+		NewRule("S", Expr{Literal("b"), Ref("B"), Literal("d")}),
+		NewRule("S", Expr{Literal("a"), Ref("B"), Literal("e")}),
+		NewRule("S", Expr{Literal("b"), Ref("A"), Literal("e")}),
+		NewRule("A", Expr{Literal("c")}),
+		NewRule("B", Expr{Literal("c")}),
+	}
+	// ambiguous sums are in no LR class
+	ambiguous = []Rule{
+		NewRule("E", Expr{Ref("E"), Literal("+"), Ref("E")}),
+		NewRule("E", Expr{Literal("1")}),
+	}
+	// restart derives its start variable from itself, which is then either
+	// accepted or reduced to A
+	restart = []Rule{
+		NewRule("S", Expr{Ref("A")}),
+		NewRule("A", Expr{Ref("S")}),
+		NewRule("A", Expr{Literal("x")}),
+	}
+)
+
+func TestConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		kind  Kind
+		// conflicts holds the conflicting items of each conflict, nil if the grammar is in the class
+		conflicts [][]string
+		// kinds tells the type of each conflict
+		kinds []string
+	}{
+		{
+			name:      "prefix LR(0)",
+			rules:     prefix,
+			kind:      LR0,
+			conflicts: [][]string{{"S -> 'a' •", "S -> 'a' • 'b'"}},
+			kinds:     []string{"shift/reduce"},
+		},
+		{
+			name:  "prefix SLR(1)",
+			rules: prefix,
+			kind:  SLR1,
+		},
+		{
+			name:      "assignment SLR(1)",
+			rules:     assignment,
+			kind:      SLR1,
+			conflicts: [][]string{{"S -> L • '=' R", "R -> L •"}},
+			kinds:     []string{"shift/reduce"},
+		},
+		{
+			name:  "assignment LALR(1)",
+			rules: assignment,
+			kind:  LALR1,
+		},
+		{
+			name:  "merged LR(1)",
+			rules: merged,
+			kind:  LR1,
+		},
+		{
+			name:  "merged LALR(1)",
+			rules: merged,
+			kind:  LALR1,
+			conflicts: [][]string{
+				{"A -> 'c' •, 'd'", "B -> 'c' •, 'd'"},
+				{"B -> 'c' •, 'e'", "A -> 'c' •, 'e'"},
+			},
+			kinds: []string{"reduce/reduce", "reduce/reduce"},
+		},
+		{
+			name:  "ambiguous LR(1)",
+			rules: ambiguous,
+			kind:  LR1,
+			conflicts: [][]string{
+				{"E -> E • '+' E, end of input", "E -> E • '+' E, '+'", "E -> E '+' E •, '+'"},
+			},
+			kinds: []string{"shift/reduce"},
+		},
+		{
+			name:      "start on a right-hand side LR(1)",
+			rules:     restart,
+			kind:      LR1,
+			conflicts: [][]string{{"S' -> S •, end of input", "A -> S •, end of input"}},
+			kinds:     []string{"accept/reduce"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := NewGrammar(tt.rules)
+			if err != nil {
+				t.Fatalf("NewGrammar() unexpected error: %v", err)
+			}
+			_, err = New(g, tt.kind)
+			var conflictErr *ConflictError
+			if !errors.As(err, &conflictErr) {
+				if tt.conflicts != nil {
+					t.Fatalf("New() error = %v, want *ConflictError", err)
+				}
+				return
+			}
+			if tt.conflicts == nil {
+				t.Fatalf("New() unexpected error: %v", err)
+			}
+			if len(conflictErr.Conflicts) != len(tt.conflicts) {
+				t.Fatalf("New() conflicts = %v, want %d", conflictErr.Conflicts, len(tt.conflicts))
+			}
+			for i, c := range conflictErr.Conflicts {
+				items := make([]string, len(c.Items))
+				for j, it := range c.Items {
+					items[j] = it.String()
+				}
+				if !slices.Equal(items, tt.conflicts[i]) {
+					t.Errorf("conflict %d items = %q, want %q", i, items, tt.conflicts[i])
+				}
+				if kind, _, _ := strings.Cut(c.String(), " "); kind != tt.kinds[i] {
+					t.Errorf("conflict %d is %s, want %s", i, kind, tt.kinds[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRightParse(t *testing.T) {
+	g, err := NewGrammar(assignment)
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	p, err := New(g, LALR1)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		input      string
+		rightParse []int
+		leftParse  []int
+	}{
+		{input: "x", rightParse: []int{3, 4, 1}, leftParse: []int{1, 4, 3}},
+		{input: "x=*x", rightParse: []int{3, 3, 4, 2, 4, 0}, leftParse: []int{0, 3, 4, 2, 4, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			rightParse, err := p.ParseRight(tt.input)
+			if err != nil {
+				t.Fatalf("ParseRight() unexpected error: %v", err)
+			}
+			if !slices.Equal(rightParse, tt.rightParse) {
+				t.Errorf("ParseRight() = %v, want %v", rightParse, tt.rightParse)
+			}
+			leftParse, err := g.LeftParseOf(rightParse)
+			if err != nil {
+				t.Fatalf("LeftParseOf() unexpected error: %v", err)
+			}
+			if !slices.Equal(leftParse, tt.leftParse) {
+				t.Errorf("LeftParseOf() = %v, want %v", leftParse, tt.leftParse)
+			}
+			direct, err := p.Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse() unexpected error: %v", err)
+			}
+			if !slices.Equal(direct, leftParse) {
+				t.Errorf("Parse() = %v, want %v", direct, leftParse)
+			}
+			tree, err := p.ParseTree(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTree() unexpected error: %v", err)
+			}
+			tree.Walk(func(node *ParseTree) bool {
+				if _, ok := node.Terminal.(Literal); node.IsLeaf() && !ok {
+					t.Errorf("ParseTree() leaf %#v, want a Literal", node.Terminal)
+				}
+				return true
+			})
+			result, err := g.EvalLeftParse(leftParse)
+			if err != nil {
+				t.Fatalf("EvalLeftParse() unexpected error: %v", err)
+			}
+			if result != tt.input {
+				t.Errorf("EvalLeftParse() = %q, want %q", result, tt.input)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	g, err := NewGrammar(assignment)
+	if err != nil {
+		t.Fatalf("NewGrammar() unexpected error: %v", err)
+	}
+	p, err := New(g, LR1)
+	if err != nil {
+		t.Fatalf("New() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{input: "", err: "Unexpected end of input, expected one of '*', 'x'"},
+		{input: "x=", err: "Unexpected end of input, expected one of '*', 'x'"},
+		{input: "xx", err: "Unexpected 'x' at offset 1, expected one of end of input, '='"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := p.Parse(tt.input)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Parse() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestKernelKey(t *testing.T) {
+	// Both kernels print as [{0 1 x} {2 3 y}]
+	a := []item{{rule: 0, dot: 1, lookahead: "x} {2 3 y"}}
+	b := []item{{rule: 0, dot: 1, lookahead: "x"}, {rule: 2, dot: 3, lookahead: "y"}}
+	if kernelKey(a) == kernelKey(b) {
+		t.Errorf("kernelKey() = %q for distinct kernels", kernelKey(a))
+	}
+}
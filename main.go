@@ -1,55 +1,134 @@
+// Command parsing-fun parses, transforms, analyzes and generates sentences of
+// grammars written in the format read by common.ParseGrammar.
+//
+// Usage:
+//
+//	parsing-fun parse [-algorithm earley] [-output tree] grammar.bnf [input...]
+//	parsing-fun transform grammar.bnf transformation...
+//	parsing-fun analyze [-check property,...] grammar.bnf
+//	parsing-fun generate [-n 10] [-length 8] [-random [-seed 1] [-target n]] grammar.bnf
+//
+// A grammar file named "-" is read from stdin. Inputs to parse default to the
+// lines of stdin.
+//
+// The exit status is 0 on success, 1 when an input is rejected or a checked
+// property does not hold, and 2 on usage, I/O or grammar errors.
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"os"
 
 	. "github.com/costowell/parsing-fun/common"
-	"github.com/costowell/parsing-fun/earley"
 )
 
+const (
+	exitOK = iota
+	// exitFailure is returned for rejected inputs and properties that do not hold
+	exitFailure
+	// exitError is returned for usage, I/O and grammar errors
+	exitError
+)
+
+// command runs a subcommand on its arguments, returning the exit status
+type command struct {
+	name    string
+	summary string
+	run     func(env *env, args []string) int
+}
+
+// env holds the streams a command works with
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = []command{
+	{name: "parse", summary: "parse inputs and print their parse trees", run: runParse},
+	{name: "transform", summary: "apply transformations and print the resulting grammar", run: runTransform},
+	{name: "analyze", summary: "print the properties of a grammar", run: runAnalyze},
+	{name: "generate", summary: "print sentences of a grammar, shortest first or at random", run: runGenerate},
+}
+
 func main() {
-	_ = []Rule{
-		NewRule("S", Expr{"a", Ref("S"), "a"}),
-		NewRule("S", Expr{"b", Ref("S"), "b"}),
-		NewRule("S", Expr{}),
-		NewRule("S", Expr{"a"}),
-		NewRule("S", Expr{"b"}),
-	}
-	rulesB := []Rule{
-		NewRule("S0", Expr{Ref("Na"), Ref("A02")}),
-		NewRule("S0", Expr{Ref("Nb"), Ref("A12")}),
-		NewRule("S0", Expr{"a"}),
-		NewRule("S0", Expr{"b"}),
-		NewRule("A12", Expr{Ref("_S"), Ref("Nb")}),
-		NewRule("A12", Expr{"b"}),
-		NewRule("Nb", Expr{"b"}),
-		NewRule("Na", Expr{"a"}),
-		NewRule("_S", Expr{Ref("Na"), Ref("A02")}),
-		NewRule("_S", Expr{Ref("Nb"), Ref("A12")}),
-		NewRule("_S", Expr{"a"}),
-		NewRule("_S", Expr{"b"}),
-		NewRule("A02", Expr{Ref("_S"), Ref("Na")}),
-		NewRule("A02", Expr{"a"}),
-	}
-	g, err := NewGrammar(rulesB)
-	if err != nil {
-		fmt.Println("error creating grammar: ", err.Error())
-		return
+	os.Exit(run(os.Args[1:], &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}))
+}
+
+func run(args []string, e *env) int {
+	if len(args) == 0 {
+		e.usage()
+		return exitError
 	}
-	fmt.Println(g)
-	cnf, err := g.ToCNF()
-	if err != nil {
-		fmt.Println("error creating CNF grammar: ", err.Error())
-		return
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(e, args[1:])
+		}
 	}
-	fmt.Println("-------------------------")
-	fmt.Println(cnf.String())
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		e.usage()
+		return exitOK
+	}
+	e.errorf("Unknown command '%s'", args[0])
+	e.usage()
+	return exitError
+}
 
-	parser := earley.New(g)
-	leftParse, err := parser.Parse("ababa")
+func (e *env) usage() {
+	fmt.Fprintf(e.stderr, "Usage: parsing-fun <command> [flags] grammar [args...]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(e.stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(e.stderr, "\nRun 'parsing-fun <command> -h' for the flags of a command.\n")
+}
+
+func (e *env) errorf(format string, args ...any) {
+	fmt.Fprintf(e.stderr, "parsing-fun: %s\n", fmt.Sprintf(format, args...))
+}
+
+// flags returns a flag set for a command reporting errors to stderr
+func (e *env) flags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: parsing-fun %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the flags of a command, returning the exit status to stop
+// with if there is nothing left to do
+func parseFlags(fs *flag.FlagSet, args []string, minArgs int) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitError, false
+	}
+	if fs.NArg() < minArgs {
+		fs.Usage()
+		return exitError, false
+	}
+	return exitOK, true
+}
+
+// loadGrammar reads the grammar file at path, stdin for "-"
+func (e *env) loadGrammar(path string) (*Grammar, error) {
+	if path == "-" {
+		return ParseGrammar(e.stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g, err := ParseGrammar(f)
 	if err != nil {
-		fmt.Println("error parsing CNF grammar: ", err.Error())
-		return
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
 	}
-	fmt.Println("Left Parse: ", leftParse)
+	return g, nil
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		status int
+		stdout string
+		stderr string
+	}{
+		{
+			name:   "left parse",
+			args:   []string{"parse", "-output", "left", "examples/arithmetic.bnf", "1+2"},
+			stdout: "0 1 3 5 7 3 5 8\n",
+		},
+		{
+			name:   "right parse",
+			args:   []string{"parse", "-algorithm", "lalr1", "-output", "right", "examples/arithmetic.bnf", "1+2"},
+			stdout: "7 5 3 1 8 5 3 0\n",
+		},
+		{
+			name:   "inputs from stdin",
+			args:   []string{"parse", "-algorithm", "cyk", "-output", "left", "examples/palindromes.bnf"},
+			stdin:  "aba\nab\nbb\n",
+			status: exitFailure,
+			stdout: "0 3\n1 4\n",
+		},
+		{
+			name:   "tokens",
+			args:   []string{"parse", "-algorithm", "lr1", "-output", "left", "-tokens", "examples/json.bnf", "[ NUMBER , null ]"},
+			stdout: "1 9 16 3 14 6 15\n",
+		},
+		{
+			name:   "tree",
+			args:   []string{"parse", "-algorithm", "slr1", "-", "x"},
+			stdin:  "S -> 'x'",
+			stdout: "S (0) [0:1]\n  'x' [0:1]\n",
+		},
+		{
+			name:   "recover",
+			args:   []string{"parse", "-recover", "-", "1+)2"},
+			stdin:  "S -> S '+' N | N ; N -> '1' | '2'",
+			status: exitFailure,
+			stdout: "S (0) [0:4]\n  S (1) [0:1]\n    N (2) [0:1]\n      '1' [0:1]\n  '+' [1:2]\n  N (3) [2:4]\n    error: skipped [2:3]\n    '2' [3:4]\n",
+		},
+		{
+			name:   "trace",
+			args:   []string{"parse", "-trace", "-", "x"},
+			stdin:  "S -> 'x'",
+			stdout: "S (0) [0:1]\n  'x' [0:1]\n",
+			stderr: "predict (S -> •'x' , 0..0)\nscan 'x' (S -> 'x' •, 0..1)\ncomplete (S -> 'x' •, 0..1)\ncomplete (_P -> S •, 0..1)\n",
+		},
+		{
+			name:   "recover with an algorithm that cannot",
+			args:   []string{"parse", "-recover", "-algorithm", "lalr1", "examples/arithmetic.bnf", "1+"},
+			status: exitError,
+		},
+		{
+			name:   "not in the class of the algorithm",
+			args:   []string{"parse", "-algorithm", "lr0", "examples/palindromes.bnf", "a"},
+			status: exitError,
+		},
+		{
+			name:   "unknown algorithm",
+			args:   []string{"parse", "-algorithm", "peg", "examples/palindromes.bnf", "a"},
+			status: exitError,
+		},
+		{
+			name:   "transform",
+			args:   []string{"transform", "-", "remove-epsilon", "remove-unit"},
+			stdin:  "S -> A 'b' A ; A -> 'a' | ε",
+			stdout: "S -> A 'b' A | 'b' A | A 'b' | 'b' ;\nA -> 'a' ;\n",
+		},
+		{
+			name:   "transform trace",
+			args:   []string{"transform", "-trace", "-", "remove-useless"},
+			stdin:  "S -> 'a' | B ; B -> B 'b'",
+			stdout: "S -> 'a' ;\n",
+			stderr: "remove unproductive variables: 1 rules, 1 variables\nremove unreachable variables: 1 rules, 1 variables\n",
+		},
+		{
+			name:   "transform token kinds",
+			args:   []string{"transform", "-", "remove-useless"},
+			stdin:  "%token X Y ; S -> X 'x\\'' | S ; T -> Y",
+			stdout: "%token X ;\nS -> X 'x\\'' | S ;\n",
+		},
+		{
+			name:   "unknown transformation",
+			args:   []string{"transform", "examples/arithmetic.bnf", "cnf", "bogus"},
+			status: exitError,
+		},
+		{
+			name:   "analyze",
+			args:   []string{"analyze", "-q", "-check", "cycle-free,epsilon-free,no-useless", "examples/arithmetic.bnf"},
+			status: exitOK,
+		},
+		{
+			name:   "analyze failed check",
+			args:   []string{"analyze", "-q", "-check", "cycle-free,not-left-recursive", "examples/arithmetic.bnf"},
+			status: exitFailure,
+		},
+		{
+			name:   "generate",
+			args:   []string{"generate", "-n", "6", "examples/palindromes.bnf"},
+			stdout: "\na\nb\naa\nbb\naaa\n",
+		},
+		{
+			name:   "generate up to a length",
+			args:   []string{"generate", "-n", "0", "-length", "2", "examples/arithmetic.bnf"},
+			stdout: "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+		},
+		{
+			name:   "generate token kinds",
+			args:   []string{"generate", "-n", "7", "-length", "2", "examples/json.bnf"},
+			stdout: "NUMBER\nSTRING\nfalse\nnull\ntrue\n[ ]\n{ }\n",
+		},
+		{
+			name:   "generate random",
+			args:   []string{"generate", "-random", "-n", "4", "-target", "3", "-left", "examples/palindromes.bnf"},
+			stdout: "aba\t0 3\nbbb\t1 3\nbbb\t1 3\naaa\t0 2\n",
+		},
+		{
+			name:   "generate random empty",
+			args:   []string{"generate", "-random", "-n", "2", "-target", "0", "-left", "examples/palindromes.bnf"},
+			stdout: "\t4\n\t4\n",
+		},
+		{
+			name:   "generate random too shallow",
+			args:   []string{"generate", "-random", "-depth", "1", "examples/arithmetic.bnf"},
+			status: exitError,
+		},
+		{
+			name:   "missing grammar",
+			args:   []string{"analyze", "examples/missing.bnf"},
+			status: exitError,
+		},
+		{
+			name:   "invalid grammar",
+			args:   []string{"analyze", "-"},
+			stdin:  "S -> T",
+			status: exitError,
+		},
+		{
+			name:   "unknown command",
+			args:   []string{"compile"},
+			status: exitError,
+		},
+		{
+			name:   "no command",
+			status: exitError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(tt.args, &env{stdin: strings.NewReader(tt.stdin), stdout: &stdout, stderr: &stderr})
+			if status != tt.status {
+				t.Errorf("run() exit status %d, wanted %d\n%s", status, tt.status, stderr.String())
+			}
+			if tt.stdout != "" && stdout.String() != tt.stdout {
+				t.Errorf("run() printed\n%s\nwanted\n%s", stdout.String(), tt.stdout)
+			}
+			if tt.stderr != "" && stderr.String() != tt.stderr {
+				t.Errorf("run() printed to stderr\n%s\nwanted\n%s", stderr.String(), tt.stderr)
+			}
+		})
+	}
+}
+
+// failingWriter fails every write, like a closed stdout
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write /dev/stdout: broken pipe")
+}
+
+func TestTransformWriteError(t *testing.T) {
+	var stderr bytes.Buffer
+	status := run([]string{"transform", "examples/arithmetic.bnf", "remove-useless"}, &env{stdin: strings.NewReader(""), stdout: failingWriter{}, stderr: &stderr})
+	if status != exitError {
+		t.Errorf("run() exit status %d, wanted %d", status, exitError)
+	}
+	if !strings.Contains(stderr.String(), "broken pipe") {
+		t.Errorf("run() printed to stderr\n%s\nwanted the write error", stderr.String())
+	}
+}
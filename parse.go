@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"unicode"
+
+	. "github.com/costowell/parsing-fun/common"
+	"github.com/costowell/parsing-fun/cyk"
+	"github.com/costowell/parsing-fun/earley"
+	"github.com/costowell/parsing-fun/ll1"
+	"github.com/costowell/parsing-fun/lr"
+)
+
+var algorithms = map[string]func(g *Grammar) (TreeParser, error){
+	"earley": func(g *Grammar) (TreeParser, error) { return earley.New(g), nil },
+	"cyk":    cyk.New,
+	"ll1":    ll1.New,
+	"lr0":    lrParser(lr.LR0),
+	"slr1":   lrParser(lr.SLR1),
+	"lalr1":  lrParser(lr.LALR1),
+	"lr1":    lrParser(lr.LR1),
+}
+
+func lrParser(kind lr.Kind) func(g *Grammar) (TreeParser, error) {
+	return func(g *Grammar) (TreeParser, error) {
+		return lr.New(g, kind)
+	}
+}
+
+var outputs = map[string]func(tree *ParseTree) string{
+	"tree": (*ParseTree).String,
+	"left": func(tree *ParseTree) string {
+		return ruleNumbers(tree.LeftParse())
+	},
+	// The reductions of a bottom-up parser, a rightmost derivation in reverse
+	"right": func(tree *ParseTree) string {
+		var rules []int
+		tree.WalkPostOrder(func(node *ParseTree) {
+			if !node.IsLeaf() {
+				rules = append(rules, node.Rule)
+			}
+		})
+		return ruleNumbers(rules)
+	},
+}
+
+func ruleNumbers(rules []int) string {
+	return strings.Trim(fmt.Sprint(rules), "[]") + "\n"
+}
+
+func runParse(e *env, args []string) int {
+	fs := e.flags("parse", "grammar [input...]")
+	algorithm := fs.String("algorithm", "earley", "parsing algorithm: earley, cyk, ll1, lr0, slr1, lalr1 or lr1")
+	output := fs.String("output", "tree", "what to print for accepted inputs: tree, left or right (parse)")
+	tokens := fs.Bool("tokens", false, "inputs are whitespace-separated token kinds instead of raw text")
+	repair := fs.Bool("recover", false, "repair rejected inputs, printing every error and the best-effort tree (earley)")
+	trace := fs.Bool("trace", false, "print the predictions, scans and completions of the parser to stderr (earley)")
+	if status, ok := parseFlags(fs, args, 1); !ok {
+		return status
+	}
+
+	newParser, ok := algorithms[*algorithm]
+	if !ok {
+		e.errorf("Unknown algorithm '%s'", *algorithm)
+		return exitError
+	}
+	format, ok := outputs[*output]
+	if !ok {
+		e.errorf("Unknown output '%s'", *output)
+		return exitError
+	}
+	g, err := e.loadGrammar(fs.Arg(0))
+	if err != nil {
+		e.errorf("%s", err.Error())
+		return exitError
+	}
+	if *trace {
+		g.Tracer = NewLogTracer(e.stderr)
+	}
+	parser, err := newParser(g)
+	if err != nil {
+		e.errorf("%s", err.Error())
+		return exitError
+	}
+	recovering, ok := parser.(RecoveringParser)
+	if *repair && !ok {
+		e.errorf("Algorithm '%s' does not recover from errors", *algorithm)
+		return exitError
+	}
+
+	inputs := fs.Args()[1:]
+	if len(inputs) == 0 {
+		if fs.Arg(0) == "-" {
+			e.errorf("Inputs must be given as arguments when the grammar is read from stdin")
+			return exitError
+		}
+		scanner := bufio.NewScanner(e.stdin)
+		for scanner.Scan() {
+			inputs = append(inputs, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			e.errorf("%s", err.Error())
+			return exitError
+		}
+	}
+
+	status := exitOK
+	for _, input := range inputs {
+		if *repair {
+			var tree *ParseTree
+			var errs []*ParseError
+			if *tokens {
+				tree, errs = recovering.ParseTokensRecover(splitTokens(input))
+			} else {
+				tree, errs = recovering.ParseRecover(input)
+			}
+			for _, err := range errs {
+				e.errorf("%q: %s", input, err.Error())
+				status = exitFailure
+			}
+			if tree != nil {
+				fmt.Fprint(e.stdout, format(tree))
+			}
+			continue
+		}
+
+		var tree *ParseTree
+		if *tokens {
+			tree, err = parser.ParseTokensTree(splitTokens(input))
+		} else {
+			tree, err = parser.ParseTree(input)
+		}
+		if err != nil {
+			e.errorf("%q: %s", input, err.Error())
+			status = exitFailure
+			continue
+		}
+		fmt.Fprint(e.stdout, format(tree))
+	}
+	return status
+}
+
+// splitTokens returns the whitespace-separated fields of input as tokens of their own kind
+func splitTokens(input string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range input + " " {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			lexeme := input[start:i]
+			tokens = append(tokens, Token{Kind: Terminal(lexeme), Lexeme: lexeme, Span: Span{Start: start, End: i}})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+
+	. "github.com/costowell/parsing-fun/common"
+)
+
+var transformations = []struct {
+	name string
+	fn   func(g *Grammar) (*Grammar, error)
+}{
+	{"cnf", (*Grammar).ToCNF},
+	{"gnf", (*Grammar).ToGNF},
+	{"remove-left-recursion", (*Grammar).RemoveLeftRecursion},
+	{"remove-epsilon", (*Grammar).RemoveEpsilon},
+	{"remove-unit", (*Grammar).RemoveUnit},
+	{"remove-cycles", (*Grammar).RemoveCycles},
+	{"remove-useless", (*Grammar).RemoveUseless},
+	{"remove-unproductive", (*Grammar).RemoveUnproductive},
+	{"remove-unreachable", (*Grammar).RemoveUnreachable},
+}
+
+func runTransform(e *env, args []string) int {
+	names := make([]string, len(transformations))
+	for i, t := range transformations {
+		names[i] = t.name
+	}
+	fs := e.flags("transform", "grammar transformation...\n\nTransformations are applied in order: "+strings.Join(names, ", "))
+	trace := fs.Bool("trace", false, "print every step of the transformations to stderr")
+	if status, ok := parseFlags(fs, args, 2); !ok {
+		return status
+	}
+
+	g, err := e.loadGrammar(fs.Arg(0))
+	if err != nil {
+		e.errorf("%s", err.Error())
+		return exitError
+	}
+	if *trace {
+		g.Tracer = NewLogTracer(e.stderr)
+	}
+next:
+	for _, name := range fs.Args()[1:] {
+		for _, t := range transformations {
+			if t.name == name {
+				if g, err = t.fn(g); err != nil {
+					e.errorf("%s: %s", name, err.Error())
+					return exitError
+				}
+				continue next
+			}
+		}
+		e.errorf("Unknown transformation '%s'", name)
+		return exitError
+	}
+	text, err := g.MarshalText()
+	if err != nil {
+		e.errorf("%s", err.Error())
+		return exitError
+	}
+	if _, err := e.stdout.Write(text); err != nil {
+		e.errorf("%s", err.Error())
+		return exitError
+	}
+	return exitOK
+}